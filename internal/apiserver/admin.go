@@ -0,0 +1,111 @@
+package apiserver
+
+import (
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/middleware"
+	"monica-proxy/internal/service"
+	"monica-proxy/internal/types"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// registerAdminRoutes 注册管理接口，使用单独的管理 Token 认证
+func registerAdminRoutes(e *echo.Echo, cfg *config.Config, adminService service.AdminService) {
+	admin := e.Group(middleware.AdminPathPrefix, middleware.AdminAuth(cfg))
+	admin.GET("/config", createAdminConfigHandler(adminService))
+	admin.GET("/account", createAdminAccountHandler(adminService))
+	admin.POST("/account/disable", createAdminSetAccountDisabledHandler(adminService, true))
+	admin.POST("/account/enable", createAdminSetAccountDisabledHandler(adminService, false))
+	admin.GET("/requests", createAdminRequestsHandler(adminService))
+	admin.POST("/requests/:id/cancel", createAdminCancelRequestHandler(adminService))
+	admin.GET("/rate-limit/clients", createAdminRateLimitHandler())
+	admin.GET("/cache", createAdminCacheHandler(adminService))
+	admin.GET("/log-level", createAdminGetLogLevelHandler(adminService))
+	admin.PUT("/log-level", createAdminSetLogLevelHandler(adminService))
+}
+
+// createAdminConfigHandler 创建查看当前配置的处理器
+func createAdminConfigHandler(adminService service.AdminService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, adminService.Config())
+	}
+}
+
+// createAdminAccountHandler 创建查看 Monica 账号状态的处理器
+func createAdminAccountHandler(adminService service.AdminService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, adminService.Account())
+	}
+}
+
+// createAdminSetAccountDisabledHandler 创建禁用或启用 Monica 账号的处理器
+func createAdminSetAccountDisabledHandler(adminService service.AdminService, disabled bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, adminService.SetAccountDisabled(disabled))
+	}
+}
+
+// createAdminRequestsHandler 创建查看正在处理的请求的处理器
+func createAdminRequestsHandler(adminService service.AdminService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]any{
+			"object": "list",
+			"data":   adminService.Requests(),
+		})
+	}
+}
+
+// createAdminCancelRequestHandler 创建取消请求的处理器
+func createAdminCancelRequestHandler(adminService service.AdminService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+		if err := adminService.CancelRequest(id); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, map[string]any{"id": id, "cancelled": true})
+	}
+}
+
+// createAdminRateLimitHandler 创建查看限流客户端的处理器，未启用限流时返回空列表
+func createAdminRateLimitHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		clients := middleware.RateLimitClients()
+		if clients == nil {
+			clients = []middleware.RateLimitClient{}
+		}
+		return c.JSON(http.StatusOK, map[string]any{
+			"object": "list",
+			"data":   clients,
+		})
+	}
+}
+
+// createAdminCacheHandler 创建查看缓存统计的处理器
+func createAdminCacheHandler(adminService service.AdminService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, adminService.CacheStats())
+	}
+}
+
+// createAdminGetLogLevelHandler 创建查看日志级别的处理器
+func createAdminGetLogLevelHandler(adminService service.AdminService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, types.AdminLogLevel{Level: adminService.LogLevel()})
+	}
+}
+
+// createAdminSetLogLevelHandler 创建修改日志级别的处理器
+func createAdminSetLogLevelHandler(adminService service.AdminService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req types.AdminLogLevel
+		if err := c.Bind(&req); err != nil {
+			return errors.NewBadRequestError("无效的请求数据", err)
+		}
+		if err := adminService.SetLogLevel(req.Level); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, types.AdminLogLevel{Level: adminService.LogLevel()})
+	}
+}
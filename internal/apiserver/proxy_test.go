@@ -0,0 +1,171 @@
+package apiserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image/png"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/types"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestChatCompletionThroughMock(t *testing.T) {
+	proxy, _ := newTestProxy(t, nil)
+	const want = "This is a mock reply from gpt_4_o_chat. You said: hi"
+	request := func(stream bool) map[string]any {
+		return map[string]any{
+			"model":    "gpt-4o",
+			"stream":   stream,
+			"messages": []map[string]string{{"role": "user", "content": "hi"}},
+		}
+	}
+
+	t.Run("non-stream", func(t *testing.T) {
+		resp, body := postJSON(t, proxy.URL+"/v1/chat/completions", request(false), nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+		}
+		var completion openai.ChatCompletionResponse
+		if err := json.Unmarshal(body, &completion); err != nil {
+			t.Fatal(err)
+		}
+		if len(completion.Choices) != 1 {
+			t.Fatalf("got %d choices, want 1", len(completion.Choices))
+		}
+		choice := completion.Choices[0]
+		if choice.Message.Content != want || choice.FinishReason != openai.FinishReasonStop {
+			t.Errorf("choice = %q (%s), want %q (stop)", choice.Message.Content, choice.FinishReason, want)
+		}
+		if completion.ID != "chatcmpl-"+resp.Header.Get("X-Request-Id") {
+			t.Errorf("id = %s, want chatcmpl-<X-Request-Id>", completion.ID)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		resp, body := postJSON(t, proxy.URL+"/v1/chat/completions", request(true), nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+		}
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+			t.Errorf("Content-Type = %s, want text/event-stream", ct)
+		}
+
+		var content strings.Builder
+		var finishReason openai.FinishReason
+		done := false
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			if data == "[DONE]" {
+				done = true
+				continue
+			}
+			var chunk types.ChatCompletionStreamResponse
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				t.Fatalf("invalid chunk %q: %v", data, err)
+			}
+			content.WriteString(chunk.Choices[0].Delta.Content)
+			if chunk.Choices[0].FinishReason != "" {
+				finishReason = chunk.Choices[0].FinishReason
+			}
+		}
+		if content.String() != want || finishReason != openai.FinishReasonStop || !done {
+			t.Errorf("stream = %q (%s, done %v), want %q (stop, done)", content.String(), finishReason, done, want)
+		}
+	})
+}
+
+func TestImageGenerationThroughMock(t *testing.T) {
+	proxy, _ := newTestProxy(t, nil)
+
+	for _, format := range []string{"url", "b64_json"} {
+		t.Run(format, func(t *testing.T) {
+			resp, body := postJSON(t, proxy.URL+"/v1/images/generations", map[string]any{
+				"model":           "dall-e-3",
+				"prompt":          "a red square",
+				"n":               2,
+				"size":            "1024x1024",
+				"response_format": format,
+			}, nil)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+			}
+			var images types.ImageGenerationResponse
+			if err := json.Unmarshal(body, &images); err != nil {
+				t.Fatal(err)
+			}
+			if len(images.Data) != 2 {
+				t.Fatalf("got %d images, want 2", len(images.Data))
+			}
+
+			for i, image := range images.Data {
+				var data []byte
+				if format == "url" {
+					imageResp, err := http.Get(image.URL)
+					if err != nil {
+						t.Fatal(err)
+					}
+					var buf bytes.Buffer
+					_, err = buf.ReadFrom(imageResp.Body)
+					imageResp.Body.Close()
+					if err != nil {
+						t.Fatal(err)
+					}
+					data = buf.Bytes()
+				} else {
+					if image.URL != "" {
+						t.Errorf("images[%d].url = %s, want empty for b64_json", i, image.URL)
+					}
+					var err error
+					if data, err = base64.StdEncoding.DecodeString(image.B64JSON); err != nil {
+						t.Fatal(err)
+					}
+				}
+				img, err := png.Decode(bytes.NewReader(data))
+				if err != nil {
+					t.Fatalf("images[%d] is not a png: %v", i, err)
+				}
+				if b := img.Bounds(); b.Dx() != b.Dy() {
+					t.Errorf("images[%d] is %dx%d, want square", i, b.Dx(), b.Dy())
+				}
+			}
+		})
+	}
+}
+
+func TestImageProxyIgnoresHostHeader(t *testing.T) {
+	t.Setenv("MONICA_COOKIE", "mock")
+	t.Setenv("BEARER_TOKEN", testToken)
+	t.Setenv("IMAGE_PROXY_ENABLED", "true")
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "IMAGE_PUBLIC_BASE_URL") {
+		t.Fatalf("config.Load() error = %v, want IMAGE_PUBLIC_BASE_URL required", err)
+	}
+
+	proxy, _ := newTestProxy(t, map[string]string{
+		"IMAGE_PROXY_ENABLED":   "true",
+		"IMAGE_PUBLIC_BASE_URL": "https://images.example.com/",
+	})
+
+	header := http.Header{"Host": {"evil.example"}, "X-Forwarded-Host": {"evil.example"}}
+	resp, body := postJSON(t, proxy.URL+"/v1/images/generations", map[string]any{"model": "dall-e-3", "prompt": "a red square"}, header)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+	}
+
+	var images types.ImageGenerationResponse
+	if err := json.Unmarshal(body, &images); err != nil {
+		t.Fatal(err)
+	}
+	if len(images.Data) != 1 || !strings.HasPrefix(images.Data[0].URL, "https://images.example.com/v1/images/content/") {
+		t.Errorf("images = %+v, want url under the configured base", images.Data)
+	}
+}
@@ -3,17 +3,22 @@ package apiserver
 import (
 	"fmt"
 	"io"
+	"monica-proxy/internal/audit"
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/errors"
+	"monica-proxy/internal/inflight"
 	"monica-proxy/internal/logger"
+	"monica-proxy/internal/metrics"
 	"monica-proxy/internal/middleware"
 	"monica-proxy/internal/monica"
 	"monica-proxy/internal/service"
+	"monica-proxy/internal/storage"
 	"monica-proxy/internal/types"
+	"monica-proxy/internal/version"
 	"net/http"
+	"strings"
 
 	"github.com/labstack/echo/v4"
-	"github.com/sashabaranov/go-openai"
 	"go.uber.org/zap"
 )
 
@@ -22,37 +27,127 @@ func RegisterRoutes(e *echo.Echo, cfg *config.Config) {
 	// 设置自定义错误处理器
 	e.HTTPErrorHandler = middleware.ErrorHandler()
 
-	// 添加中间件
+	// 审计日志，未启用时为 nil
+	auditLogger, err := audit.NewLogger(cfg.Audit)
+	if err != nil {
+		logger.Fatal("创建审计日志失败", zap.Error(err))
+	}
+
+	// 正在处理的请求，可以通过管理接口查看和取消
+	requests := inflight.NewRegistry()
+
+	// 添加中间件，指标中间件放在认证之前以便统计被拒绝的请求
+	e.Use(middleware.Metrics(cfg))
 	e.Use(middleware.BearerAuth(cfg))
+	e.Use(middleware.Audit(cfg, auditLogger))
+	e.Use(middleware.InFlight(cfg, requests))
 	e.Use(middleware.RequestLogger(cfg))
 
+	// 加载已上传文件的记录
+	fileStore, err := storage.NewFileStore(cfg.Upload.FileStorePath, cfg.Upload.CacheTTL)
+	if err != nil {
+		logger.Fatal("加载文件存储失败", zap.Error(err))
+	}
+
+	// 启用图片代理时，生成的图片保存在本地
+	var imageStore *storage.ImageStore
+	if cfg.Image.ProxyEnabled {
+		imageStore, err = storage.NewImageStore(cfg.Image.StoreDir, cfg.Image.StoreTTL)
+		if err != nil {
+			logger.Fatal("创建图片存储失败", zap.Error(err))
+		}
+	}
+
 	// 初始化服务实例
-	chatService := service.NewChatService(cfg)
+	fileService := service.NewFileService(cfg, fileStore)
+	chatService := service.NewChatService(cfg, fileService)
 	modelService := service.NewModelService(cfg)
-	imageService := service.NewImageService(cfg)
-	customBotService := service.NewCustomBotService(cfg)
+	imageService := service.NewImageService(cfg, imageStore)
+	imageJobService := service.NewImageJobService(cfg, imageService)
+	customBotService := service.NewCustomBotService(cfg, fileService)
+	healthService := service.NewHealthService(cfg)
+	requestService := service.NewRequestService(requests)
+
+	// 健康检查和版本信息，无需认证，供 Docker/Kubernetes 探针使用
+	e.GET(middleware.HealthzPath, createHealthzHandler())
+	e.GET(middleware.ReadyzPath, createReadyzHandler(healthService))
+	e.GET(middleware.VersionPath, createVersionHandler())
+
+	// Prometheus 监控指标
+	if cfg.Metrics.Enabled {
+		metrics.SetUploadCacheStats(func() (int64, int64) {
+			stats := types.GetUploadCacheStats()
+			return stats.Hits, stats.Misses
+		})
+		metrics.SetKnownModels(metricModels(cfg))
+		e.GET(cfg.Metrics.Path, echo.WrapHandler(metrics.Handler()))
+	}
 
 	// ChatGPT 风格的请求转发到 /v1/chat/completions
 	e.POST("/v1/chat/completions", createChatCompletionHandler(chatService, customBotService, cfg))
+	// 取消正在生成的请求，id 为响应的 id 或 X-Request-Id
+	e.POST("/v1/chat/completions/:id/cancel", createCancelCompletionHandler(requestService))
 	// 获取支持的模型列表
 	e.GET("/v1/models", createListModelsHandler(modelService))
 	// DALL-E 风格的图片生成请求
-	e.POST("/v1/images/generations", createImageGenerationHandler(imageService))
+	e.POST("/v1/images/generations", createImageGenerationHandler(imageService, imageJobService, cfg))
+	// 异步图片任务的状态和结果
+	e.GET("/v1/images/jobs/:job_id", createGetImageJobHandler(imageJobService))
+	// 本地保存的生成图片，无需认证
+	e.GET(service.ImageContentPath+":id", createImageContentHandler(imageService))
+	// OpenAI Files API，文件上传到Monica后可以在消息中通过 file_id 引用
+	e.POST("/v1/files", createFileUploadHandler(fileService))
+	e.GET("/v1/files", createListFilesHandler(fileService))
+	e.GET("/v1/files/:file_id", createGetFileHandler(fileService))
+	e.DELETE("/v1/files/:file_id", createDeleteFileHandler(fileService))
 	// Custom Bot 测试接口
 	e.POST("/v1/chat/custom-bot/:bot_uid", createCustomBotHandler(customBotService, cfg))
 	// 新增不带bot_uid的路由，使用环境变量中的BOT_UID
 	e.POST("/v1/chat/custom-bot", createCustomBotHandler(customBotService, cfg))
+
+	// 管理接口
+	if cfg.Admin.Enabled {
+		registerAdminRoutes(e, cfg, service.NewAdminService(cfg, healthService, requestService))
+	}
+}
+
+// createHealthzHandler 创建存活检查处理器，进程能响应即为存活
+func createHealthzHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"status": types.HealthStatusOK})
+	}
+}
+
+// createReadyzHandler 创建就绪检查处理器，未就绪时返回 503
+func createReadyzHandler(healthService service.HealthService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		result := healthService.Readiness()
+		status := http.StatusOK
+		if result.Status != types.HealthStatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		return c.JSON(status, result)
+	}
+}
+
+// createVersionHandler 创建版本信息处理器
+func createVersionHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, version.Get())
+	}
 }
 
 // createChatCompletionHandler 创建聊天完成处理器
 func createChatCompletionHandler(chatService service.ChatService, customBotService service.CustomBotService, cfg *config.Config) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		var req openai.ChatCompletionRequest
+		var req types.ChatCompletionRequest
 		if err := c.Bind(&req); err != nil {
 			return errors.NewBadRequestError("无效的请求数据", err)
 		}
+		middleware.SetRequestModel(c, req.Model)
 
 		ctx := c.Request().Context()
+		audit.FromContext(ctx).SetRequest(&req)
 		var result interface{}
 		var err error
 
@@ -71,17 +166,14 @@ func createChatCompletionHandler(chatService service.ChatService, customBotServi
 
 		// 根据请求参数决定响应方式
 		if req.Stream {
-			// 对于流式请求，result是一个io.ReadCloser
-			rawBody, ok := result.(io.Reader)
+			// 对于流式请求，result是一个或多个响应流
+			streams, ok := toChoiceStreams(result)
 			if !ok {
 				return errors.NewInternalError(nil)
 			}
 
 			// 确保关闭响应体
-			closer, isCloser := rawBody.(io.Closer)
-			if isCloser {
-				defer closer.Close()
-			}
+			defer streams.Close()
 
 			// 设置响应头
 			c.Response().Header().Set(echo.HeaderContentType, "text/event-stream")
@@ -90,17 +182,33 @@ func createChatCompletionHandler(chatService service.ChatService, customBotServi
 			c.Response().WriteHeader(http.StatusOK)
 
 			// 流式处理响应
-			if err := monica.StreamMonicaSSEToClient(req.Model, c.Response().Writer, rawBody); err != nil {
+			if err := monica.StreamMonicaSSEToClient(c.Request().Context(), req.Model, c.Response().Writer, monica.NewOutputLimits(&req), streams.Readers()...); err != nil {
 				return errors.NewInternalError(err)
 			}
 			return nil
 		} else {
 			// 对于非流式请求，直接返回JSON响应
+			audit.FromContext(ctx).SetResponse(result)
 			return c.JSON(http.StatusOK, result)
 		}
 	}
 }
 
+// createCancelCompletionHandler 创建取消请求的处理器
+func createCancelCompletionHandler(requestService service.RequestService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+		if err := requestService.CancelRequest(id, "api"); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, map[string]any{
+			"id":        id,
+			"object":    "chat.completion.cancellation",
+			"cancelled": true,
+		})
+	}
+}
+
 // createListModelsHandler 创建模型列表处理器
 func createListModelsHandler(modelService service.ModelService) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -128,25 +236,148 @@ func createListModelsHandler(modelService service.ModelService) echo.HandlerFunc
 }
 
 // createImageGenerationHandler 创建图片生成处理器
-func createImageGenerationHandler(imageService service.ImageService) echo.HandlerFunc {
+func createImageGenerationHandler(imageService service.ImageService, imageJobService service.ImageJobService, cfg *config.Config) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		// 解析请求
 		var req types.ImageGenerationRequest
 		if err := c.Bind(&req); err != nil {
 			return errors.NewBadRequestError("无效的请求数据", err)
 		}
+		middleware.SetRequestModel(c, req.Model)
+		audit.FromContext(c.Request().Context()).SetRequest(&req)
+
+		// 异步模式立即返回任务信息
+		if req.Async || req.CallbackURL != "" {
+			job, err := imageJobService.SubmitImageJob(&req, imageBaseURL(cfg))
+			if err != nil {
+				return err
+			}
+			return c.JSON(http.StatusAccepted, job)
+		}
 
 		// 调用服务生成图片
-		resp, err := imageService.GenerateImage(c.Request().Context(), &req)
+		resp, err := imageService.GenerateImage(c.Request().Context(), &req, imageBaseURL(cfg))
 		if err != nil {
 			return err
 		}
 
 		// 返回结果
+		audit.FromContext(c.Request().Context()).SetResponse(resp)
 		return c.JSON(http.StatusOK, resp)
 	}
 }
 
+// createGetImageJobHandler 创建异步图片任务查询处理器
+func createGetImageJobHandler(imageJobService service.ImageJobService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		job, err := imageJobService.GetImageJob(c.Param("job_id"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, job)
+	}
+}
+
+// createImageContentHandler 创建本地图片访问处理器
+func createImageContentHandler(imageService service.ImageService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		path, err := imageService.GetImagePath(c.Param("id"))
+		if err != nil {
+			return err
+		}
+		c.Response().Header().Set("Cache-Control", "public, max-age=86400, immutable")
+		return c.File(path)
+	}
+}
+
+// metricModels 允许作为指标标签的模型：支持的聊天模型、配置的图片模型和配置了上下文窗口的模型
+func metricModels(cfg *config.Config) []string {
+	models := types.GetSupportedModels()
+	for model := range cfg.Image.ModelTypes {
+		models = append(models, model)
+	}
+	for model := range cfg.Context.ModelWindows {
+		models = append(models, model)
+	}
+	return models
+}
+
+// imageBaseURL 获取本地图片地址的前缀，只使用配置的地址，避免通过 Host 头伪造返回的图片地址
+func imageBaseURL(cfg *config.Config) string {
+	return strings.TrimSuffix(cfg.Image.PublicBaseURL, "/")
+}
+
+// createFileUploadHandler 创建文件上传处理器
+func createFileUploadHandler(fileService service.FileService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			return errors.NewBadRequestError("缺少file字段", err)
+		}
+		if fileHeader.Size > types.MaxFileSize {
+			return errors.NewBadRequestError(fmt.Sprintf("文件大小超过限制: %d", types.MaxFileSize), nil)
+		}
+
+		src, err := fileHeader.Open()
+		if err != nil {
+			return errors.NewBadRequestError("读取上传文件失败", err)
+		}
+		defer src.Close()
+
+		data, err := io.ReadAll(io.LimitReader(src, types.MaxFileSize+1))
+		if err != nil {
+			return errors.NewBadRequestError("读取上传文件失败", err)
+		}
+
+		purpose := c.FormValue("purpose")
+		if purpose == "" {
+			purpose = "user_data"
+		}
+
+		file, err := fileService.UploadFile(c.Request().Context(), fileHeader.Filename, purpose, data)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, file)
+	}
+}
+
+// createListFilesHandler 创建文件列表处理器
+func createListFilesHandler(fileService service.FileService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, types.FileList{
+			Object: "list",
+			Data:   fileService.ListFiles(c.QueryParam("purpose")),
+		})
+	}
+}
+
+// createGetFileHandler 创建文件详情处理器
+func createGetFileHandler(fileService service.FileService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		file, err := fileService.GetFile(c.Param("file_id"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, file)
+	}
+}
+
+// createDeleteFileHandler 创建文件删除处理器
+func createDeleteFileHandler(fileService service.FileService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		fileID := c.Param("file_id")
+		if err := fileService.DeleteFile(fileID); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, types.FileDeleteResponse{
+			ID:      fileID,
+			Object:  "file",
+			Deleted: true,
+		})
+	}
+}
+
 // createCustomBotHandler 创建Custom Bot处理器
 func createCustomBotHandler(service service.CustomBotService, cfg *config.Config) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -160,12 +391,14 @@ func createCustomBotHandler(service service.CustomBotService, cfg *config.Config
 			}
 		}
 
-		var req openai.ChatCompletionRequest
+		var req types.ChatCompletionRequest
 		if err := c.Bind(&req); err != nil {
 			return errors.NewBadRequestError("请求体解析失败", err)
 		}
+		middleware.SetRequestModel(c, req.Model)
 
 		ctx := c.Request().Context()
+		audit.FromContext(ctx).SetRequest(&req)
 		result, err := service.HandleCustomBotChat(ctx, &req, botUID)
 		if err != nil {
 			return err
@@ -179,15 +412,15 @@ func createCustomBotHandler(service service.CustomBotService, cfg *config.Config
 			c.Response().Header().Set("Connection", "keep-alive")
 			c.Response().Header().Set("Transfer-Encoding", "chunked")
 
-			// 获取响应体（io.ReadCloser）
-			stream, ok := result.(io.ReadCloser)
+			// 获取响应体（一个或多个 io.ReadCloser）
+			streams, ok := toChoiceStreams(result)
 			if !ok {
 				return errors.NewInternalError(fmt.Errorf("流式响应类型错误"))
 			}
-			defer stream.Close()
+			defer streams.Close()
 
 			// 转换并写入响应
-			err := monica.StreamMonicaSSEToClient(req.Model, c.Response().Writer, stream)
+			err := monica.StreamMonicaSSEToClient(c.Request().Context(), req.Model, c.Response().Writer, monica.NewOutputLimits(&req), streams.Readers()...)
 			if err != nil {
 				logger.Error("流式响应写入失败", zap.Error(err))
 				return err
@@ -198,6 +431,19 @@ func createCustomBotHandler(service service.CustomBotService, cfg *config.Config
 		}
 
 		// 非流式响应
+		audit.FromContext(ctx).SetResponse(result)
 		return c.JSON(http.StatusOK, result)
 	}
 }
+
+// toChoiceStreams 将服务层返回的流式结果统一为 monica.ChoiceStreams
+// n>1 时服务层返回 monica.ChoiceStreams，否则返回单个响应体
+func toChoiceStreams(result any) (monica.ChoiceStreams, bool) {
+	switch v := result.(type) {
+	case monica.ChoiceStreams:
+		return v, true
+	case io.ReadCloser:
+		return monica.ChoiceStreams{v}, true
+	}
+	return nil, false
+}
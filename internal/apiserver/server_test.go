@@ -0,0 +1,87 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/middleware"
+	"monica-proxy/internal/mock"
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/utils"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+)
+
+// testToken 测试代理使用的 Bearer Token
+const testToken = "test-token"
+
+// newTestProxy 启动以 mock.Server 为上游的代理，env 中的环境变量在加载配置前设置
+func newTestProxy(t *testing.T, env map[string]string) (*httptest.Server, *config.Config) {
+	t.Helper()
+	upstream := httptest.NewServer(nil)
+	t.Cleanup(upstream.Close)
+	upstream.Config.Handler = mock.NewServer(upstream.URL, mock.Options{}).Handler()
+
+	dir := t.TempDir()
+	t.Setenv("MONICA_BASE_URL", upstream.URL)
+	t.Setenv("MONICA_COOKIE", "mock")
+	t.Setenv("BEARER_TOKEN", testToken)
+	t.Setenv("FILE_STORE_PATH", filepath.Join(dir, "files.json"))
+	t.Setenv("IMAGE_STORE_DIR", filepath.Join(dir, "images"))
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utils.InitHTTPClients(cfg)
+	types.InitMonicaURLs(cfg)
+	types.InitUploadCache(cfg)
+
+	e := echo.New()
+	e.Use(echomiddleware.RequestID())
+	e.Use(middleware.Tracing())
+	RegisterRoutes(e, cfg)
+	proxy := httptest.NewServer(e)
+	t.Cleanup(proxy.Close)
+	return proxy, cfg
+}
+
+// postJSON 以测试 Token 发送 JSON 请求，返回响应和响应体，header 中的 Host 作为请求的 Host
+func postJSON(t *testing.T, url string, body any, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if host := header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, respBody
+}
@@ -0,0 +1,93 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/base64"
+	"monica-proxy/internal/tracing"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// tinyPNG 1x1 的 PNG 图片
+var tinyPNG, _ = base64.StdEncoding.DecodeString("iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8z8BQDwAEhQGAhKmMIQAAAABJRU5ErkJggg==")
+
+func TestTracingSpanTree(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	provider := tracing.NewProvider("monica-proxy-test", 1, exporter)
+	t.Cleanup(func() {
+		_ = provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previous)
+	})
+
+	proxy, _ := newTestProxy(t, nil)
+
+	const (
+		traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentSpanID = "00f067aa0ba902b7"
+	)
+	header := http.Header{"Traceparent": {"00-" + traceID + "-" + parentSpanID + "-01"}}
+	resp, body := postJSON(t, proxy.URL+"/v1/chat/completions", map[string]any{
+		"model": "gpt-4o",
+		"messages": []map[string]any{{
+			"role": "user",
+			"content": []map[string]any{
+				{"type": "text", "text": "What is in this image?"},
+				{"type": "image_url", "image_url": map[string]string{"url": "data:image/png;base64," + base64.StdEncoding.EncodeToString(tinyPNG)}},
+			},
+		}},
+	}, header)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+	}
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		if span.SpanContext.TraceID().String() != traceID {
+			t.Errorf("span %s has trace id %s, want %s", span.Name, span.SpanContext.TraceID(), traceID)
+		}
+		spans[span.Name] = span
+	}
+
+	// 每个 span 及其期望的父 span，根 span 的父 span 来自 traceparent
+	parents := []struct{ name, parent string }{
+		{"convert.chatgpt_to_monica", "POST /v1/chat/completions"},
+		{"upload.image", "convert.chatgpt_to_monica"},
+		{"upload.presign", "upload.image"},
+		{"upload.put", "upload.image"},
+		{"upload.create", "upload.image"},
+		{"monica.chat", "POST /v1/chat/completions"},
+	}
+	root, ok := spans["POST /v1/chat/completions"]
+	if !ok {
+		t.Fatalf("root span not exported, got %v", spanNames(spans))
+	}
+	if got := root.Parent.SpanID().String(); got != parentSpanID || !root.Parent.IsRemote() {
+		t.Errorf("root parent = %s (remote %v), want remote %s", got, root.Parent.IsRemote(), parentSpanID)
+	}
+	for _, p := range parents {
+		span, ok := spans[p.name]
+		if !ok {
+			t.Errorf("span %s not exported, got %v", p.name, spanNames(spans))
+			continue
+		}
+		if got, want := span.Parent.SpanID(), spans[p.parent].SpanContext.SpanID(); got != want {
+			t.Errorf("span %s parent = %s, want %s (%s)", p.name, got, want, p.parent)
+		}
+	}
+}
+
+// spanNames 列出导出的 span 名称，用于错误信息
+func spanNames(spans map[string]tracetest.SpanStub) []string {
+	names := make([]string, 0, len(spans))
+	for name := range spans {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,262 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/redact"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// truncatedSuffix 超出大小限制的内容被截断时追加的标记
+const truncatedSuffix = "...[truncated]"
+
+// Record 一条审计记录，每个请求一行 JSON
+type Record struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id"`
+	APIKey     string    `json:"api_key"`
+	Method     string    `json:"method"`
+	Route      string    `json:"route"`
+	Model      string    `json:"model,omitempty"`
+	Status     int       `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	// FirstTokenMs 流式响应第一段内容的耗时
+	FirstTokenMs int64 `json:"first_token_ms,omitempty"`
+
+	// Request 客户端的 OpenAI 格式请求
+	Request any `json:"request,omitempty"`
+	// UpstreamRequests 转换后发送给 Monica 的请求，n>1 或总结历史消息时有多个
+	UpstreamRequests []any `json:"upstream_requests,omitempty"`
+	// Response 非流式请求返回给客户端的响应
+	Response any `json:"response,omitempty"`
+	// StreamText 流式请求每个 choice 输出的文本
+	StreamText []string `json:"stream_text,omitempty"`
+	// Truncated 是否有内容因超过大小限制被截断
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Logger 将审计记录写入按大小轮转的 JSONL 文件
+type Logger struct {
+	config   config.AuditConfig
+	redactor *redact.Redactor
+
+	mu     sync.Mutex
+	writer *lumberjack.Logger
+}
+
+// NewLogger 创建审计日志，未启用时返回 nil，所有方法对 nil 安全
+func NewLogger(cfg config.AuditConfig) (*Logger, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.File.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("create audit log dir failed: %w", err)
+	}
+	return &Logger{
+		config:   cfg,
+		redactor: redact.New(true, cfg.RedactFields),
+		writer: &lumberjack.Logger{
+			Filename:   cfg.File.Path,
+			MaxSize:    cfg.File.MaxSize,
+			MaxAge:     cfg.File.MaxAge,
+			MaxBackups: cfg.File.MaxBackups,
+			Compress:   cfg.File.Compress,
+			LocalTime:  true,
+		},
+	}, nil
+}
+
+// Start 按采样率和 Key 的排除列表决定是否记录该请求，不记录时返回 nil
+func (l *Logger) Start(apiKey string) *Entry {
+	if l == nil {
+		return nil
+	}
+	for _, key := range l.config.ExcludeKeys {
+		if key != "" && key == apiKey {
+			return nil
+		}
+	}
+	if l.config.SampleRate < 1 && rand.Float64() >= l.config.SampleRate {
+		return nil
+	}
+	return &Entry{logger: l, start: time.Now()}
+}
+
+// write 写入一条记录
+func (l *Logger) write(record *Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.writer.Write(line)
+	return err
+}
+
+// Close 关闭审计日志文件
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.writer.Close()
+}
+
+// Entry 正在处理的请求的审计记录，处理过程中各环节通过 context 取得并补充内容
+// 所有方法对 nil 安全，未启用审计或未被采样的请求不产生开销
+type Entry struct {
+	logger *Logger
+	start  time.Time
+
+	mu         sync.Mutex
+	record     Record
+	streamText []strings.Builder
+	firstToken time.Duration
+}
+
+// entryKey Entry 在 context 中的键
+type entryKey struct{}
+
+// WithEntry 将审计记录保存到 context
+func WithEntry(ctx context.Context, entry *Entry) context.Context {
+	if entry == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, entryKey{}, entry)
+}
+
+// FromContext 获取请求的审计记录，没有时返回 nil
+func FromContext(ctx context.Context) *Entry {
+	entry, _ := ctx.Value(entryKey{}).(*Entry)
+	return entry
+}
+
+// SetRequest 记录客户端请求
+func (e *Entry) SetRequest(req any) {
+	if e == nil || !e.logger.config.CaptureRequest {
+		return
+	}
+	body, truncated := e.capture(req)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.record.Request = body
+	e.record.Truncated = e.record.Truncated || truncated
+}
+
+// AddUpstreamRequest 记录发送给 Monica 的请求
+func (e *Entry) AddUpstreamRequest(req any) {
+	if e == nil || !e.logger.config.CaptureUpstream {
+		return
+	}
+	body, truncated := e.capture(req)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.record.UpstreamRequests = append(e.record.UpstreamRequests, body)
+	e.record.Truncated = e.record.Truncated || truncated
+}
+
+// SetResponse 记录非流式请求的响应
+func (e *Entry) SetResponse(resp any) {
+	if e == nil || !e.logger.config.CaptureResponse {
+		return
+	}
+	body, truncated := e.capture(resp)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.record.Response = body
+	e.record.Truncated = e.record.Truncated || truncated
+}
+
+// AppendStreamText 追加流式响应第 index 个 choice 输出的文本
+func (e *Entry) AppendStreamText(index int, text string) {
+	if e == nil || text == "" {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.firstToken == 0 {
+		e.firstToken = time.Since(e.start)
+	}
+	if !e.logger.config.CaptureResponse {
+		return
+	}
+	for len(e.streamText) <= index {
+		e.streamText = append(e.streamText, strings.Builder{})
+	}
+	e.streamText[index].WriteString(text)
+}
+
+// RequestInfo 请求处理完成后由中间件补充的信息
+type RequestInfo struct {
+	RequestID string
+	APIKey    string
+	Method    string
+	Route     string
+	Model     string
+	Status    int
+}
+
+// Finish 补充请求信息和结果并写入审计日志
+func (e *Entry) Finish(info RequestInfo, err error) error {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	record := e.record
+	record.Time = e.start
+	record.RequestID = info.RequestID
+	record.APIKey = info.APIKey
+	record.Method = info.Method
+	record.Route = info.Route
+	record.Model = info.Model
+	record.Status = info.Status
+	record.DurationMs = time.Since(e.start).Milliseconds()
+	record.FirstTokenMs = e.firstToken.Milliseconds()
+	if err != nil {
+		record.Error = e.logger.redactor.Text(err.Error())
+	}
+	for i := range e.streamText {
+		text, truncated := e.truncate(e.logger.redactor.Text(e.streamText[i].String()))
+		record.StreamText = append(record.StreamText, text)
+		record.Truncated = record.Truncated || truncated
+	}
+	e.mu.Unlock()
+
+	return e.logger.write(&record)
+}
+
+// capture 序列化并脱敏内容，超过大小限制时截断为字符串
+func (e *Entry) capture(v any) (any, bool) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("marshal failed: %v", err), false
+	}
+	body := e.logger.redactor.Body(data)
+	if text, truncated := e.truncate(body); truncated {
+		return text, true
+	}
+	return json.RawMessage(body), false
+}
+
+// truncate 按 MaxBodyBytes 截断文本
+func (e *Entry) truncate(s string) (string, bool) {
+	limit := e.logger.config.MaxBodyBytes
+	if limit <= 0 || len(s) <= limit {
+		return s, false
+	}
+	return strings.ToValidUTF8(s[:limit], "") + truncatedSuffix, true
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -30,6 +31,33 @@ type Config struct {
 
 	// 日志配置
 	Logging LoggingConfig `yaml:"logging" json:"logging"`
+
+	// 文件上传配置
+	Upload UploadConfig `yaml:"upload" json:"upload"`
+
+	// 图片生成配置
+	Image ImageConfig `yaml:"image" json:"image"`
+
+	// 上下文窗口配置
+	Context ContextConfig `yaml:"context" json:"context"`
+
+	// 监控指标配置
+	Metrics MetricsConfig `yaml:"metrics" json:"metrics"`
+
+	// 链路追踪配置
+	Tracing TracingConfig `yaml:"tracing" json:"tracing"`
+
+	// 健康检查配置
+	Health HealthConfig `yaml:"health" json:"health"`
+
+	// 审计日志配置
+	Audit AuditConfig `yaml:"audit" json:"audit"`
+
+	// 调试配置
+	Debug DebugConfig `yaml:"debug" json:"debug"`
+
+	// 管理接口配置
+	Admin AdminConfig `yaml:"admin" json:"admin"`
 }
 
 // ServerConfig 服务器配置
@@ -48,8 +76,30 @@ type MonicaConfig struct {
 	EnableCustomBotMode bool   `yaml:"enable_custom_bot_mode" json:"enable_custom_bot_mode"`
 	DefaultLocale       string `yaml:"default_locale" json:"default_locale"`
 	DefaultAIRespLang   string `yaml:"default_ai_resp_language" json:"default_ai_resp_language"`
+	// SystemPromptStrategy 普通聊天模式下 system 消息的注入方式: prepend, pair, inject, none
+	SystemPromptStrategy string `yaml:"system_prompt_strategy" json:"system_prompt_strategy"`
+	// ImageUploadFailurePolicy 消息中的图片上传失败时的处理方式: skip, fail
+	ImageUploadFailurePolicy string `yaml:"image_upload_failure_policy" json:"image_upload_failure_policy"`
+	// MaxChoices 聊天请求 n 的上限，每个 choice 对应一个并行的 Monica 请求
+	MaxChoices int `yaml:"max_choices" json:"max_choices"`
+	// BaseURL Monica API 的地址，开发时可以指向 monica-proxy mock 启动的本地服务
+	BaseURL string `yaml:"base_url" json:"base_url"`
 }
 
+// System prompt 注入策略
+const (
+	SystemPromptPrepend = "prepend" // 拼接到第一条用户消息前
+	SystemPromptPair    = "pair"    // 作为一组虚拟的问答放在对话最前面
+	SystemPromptInject  = "inject"  // 拼接到最后一条用户消息前
+	SystemPromptNone    = "none"    // 忽略 system 消息
+)
+
+// 图片上传失败处理策略
+const (
+	ImageUploadFailureSkip = "skip" // 跳过失败的图片，继续请求
+	ImageUploadFailureFail = "fail" // 直接返回错误
+)
+
 // SecurityConfig 安全配置
 type SecurityConfig struct {
 	BearerToken      string        `yaml:"bearer_token" json:"bearer_token"`
@@ -72,11 +122,166 @@ type HTTPClientConfig struct {
 
 // LoggingConfig 日志配置
 type LoggingConfig struct {
-	Level            string `yaml:"level" json:"level"`
-	Format           string `yaml:"format" json:"format"`
-	Output           string `yaml:"output" json:"output"`
-	EnableRequestLog bool   `yaml:"enable_request_log" json:"enable_request_log"`
-	MaskSensitive    bool   `yaml:"mask_sensitive" json:"mask_sensitive"`
+	Level            string        `yaml:"level" json:"level"`
+	Format           string        `yaml:"format" json:"format"` // json, console
+	Output           string        `yaml:"output" json:"output"` // stdout, stderr, file
+	File             LogFileConfig `yaml:"file" json:"file"`
+	EnableRequestLog bool          `yaml:"enable_request_log" json:"enable_request_log"`
+	MaskSensitive    bool          `yaml:"mask_sensitive" json:"mask_sensitive"`
+	// RedactFields 日志中额外需要隐藏的 JSON 字段名，内置 cookie、token、password 等
+	RedactFields []string `yaml:"redact_fields" json:"redact_fields"`
+	// AccessOutput 请求日志的输出 (stdout, stderr, file)，为空时与应用日志相同
+	AccessOutput string        `yaml:"access_output" json:"access_output"`
+	AccessFile   LogFileConfig `yaml:"access_file" json:"access_file"`
+}
+
+// LogFileConfig 日志文件及其轮转配置
+type LogFileConfig struct {
+	Path       string `yaml:"path" json:"path"`
+	MaxSize    int    `yaml:"max_size" json:"max_size"`       // 单个文件的最大大小 (MB)，超过后轮转
+	MaxAge     int    `yaml:"max_age" json:"max_age"`         // 轮转文件的保留天数，0 表示不按时间删除
+	MaxBackups int    `yaml:"max_backups" json:"max_backups"` // 保留的轮转文件数，0 表示不按数量删除
+	Compress   bool   `yaml:"compress" json:"compress"`       // 是否使用 gzip 压缩轮转文件
+}
+
+// 日志格式和输出
+const (
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console"
+
+	LogOutputStdout = "stdout"
+	LogOutputStderr = "stderr"
+	LogOutputFile   = "file"
+)
+
+// UploadConfig 文件上传配置
+type UploadConfig struct {
+	RemoteFetchEnabled      bool          `yaml:"remote_fetch_enabled" json:"remote_fetch_enabled"`
+	RemoteFetchTimeout      time.Duration `yaml:"remote_fetch_timeout" json:"remote_fetch_timeout"`
+	RemoteFetchMaxSize      int64         `yaml:"remote_fetch_max_size" json:"remote_fetch_max_size"`
+	RemoteFetchMaxRedirects int           `yaml:"remote_fetch_max_redirects" json:"remote_fetch_max_redirects"`
+	RemoteFetchAllowPrivate bool          `yaml:"remote_fetch_allow_private" json:"remote_fetch_allow_private"`
+	// FileStorePath /v1/files 上传文件记录的保存路径，为空时只保存在内存中
+	FileStorePath string `yaml:"file_store_path" json:"file_store_path"`
+
+	// 上传缓存，避免同一文件重复上传
+	CacheMaxEntries int           `yaml:"cache_max_entries" json:"cache_max_entries"`
+	CacheMaxBytes   int64         `yaml:"cache_max_bytes" json:"cache_max_bytes"`
+	CacheTTL        time.Duration `yaml:"cache_ttl" json:"cache_ttl"`   // 应与Monica文件的有效期一致
+	CachePath       string        `yaml:"cache_path" json:"cache_path"` // 为空时不持久化
+
+	// 图片预处理，上传前缩小尺寸、重新压缩并转换不支持的格式
+	ImagePreprocess         bool  `yaml:"image_preprocess" json:"image_preprocess"`
+	ImageMaxDimension       int   `yaml:"image_max_dimension" json:"image_max_dimension"`               // detail 为 high/auto 时最长边的像素上限
+	ImageLowDetailDimension int   `yaml:"image_low_detail_dimension" json:"image_low_detail_dimension"` // detail 为 low 时最长边的像素上限
+	ImageMaxPixels          int64 `yaml:"image_max_pixels" json:"image_max_pixels"`                     // 允许解码的最大像素数（宽×高），超出时拒绝图片
+	ImageJPEGQuality        int   `yaml:"image_jpeg_quality" json:"image_jpeg_quality"`
+	ImageStripMetadata      bool  `yaml:"image_strip_metadata" json:"image_strip_metadata"` // 去除 JPEG、PNG、WebP 中的 EXIF、XMP 和文本元数据，避免泄露位置信息
+}
+
+// ImageConfig 图片生成配置
+type ImageConfig struct {
+	// ProxyEnabled 将生成的图片保存到本地，通过 /v1/images/content/{id} 提供访问，避免 Monica CDN 链接过期
+	ProxyEnabled bool          `yaml:"proxy_enabled" json:"proxy_enabled"`
+	StoreDir     string        `yaml:"store_dir" json:"store_dir"`
+	StoreTTL     time.Duration `yaml:"store_ttl" json:"store_ttl"` // 0 表示不清理
+	// PublicBaseURL 返回给客户端的图片地址前缀，启用图片代理时必须配置，不信任请求的 Host 头
+	PublicBaseURL string `yaml:"public_base_url" json:"public_base_url"`
+
+	// 异步图片任务
+	JobWorkers     int           `yaml:"job_workers" json:"job_workers"`         // 同时执行的任务数
+	JobQueueSize   int           `yaml:"job_queue_size" json:"job_queue_size"`   // 排队任务数上限，超出时拒绝提交
+	JobTimeout     time.Duration `yaml:"job_timeout" json:"job_timeout"`         // 单个任务的执行超时
+	JobTTL         time.Duration `yaml:"job_ttl" json:"job_ttl"`                 // 任务完成后结果的保留时间
+	WebhookTimeout time.Duration `yaml:"webhook_timeout" json:"webhook_timeout"` // 回调请求超时
+
+	// 图片参数映射
+	ModelTypes       map[string]string `yaml:"model_types" json:"model_types"`                 // OpenAI 模型名到 Monica model_type 的映射
+	DefaultModelType string            `yaml:"default_model_type" json:"default_model_type"`   // 未配置映射的模型使用的 model_type
+	MaxImagesPerCall int               `yaml:"max_images_per_call" json:"max_images_per_call"` // 单次 Monica 任务最多生成的图片数，超出时拆分为多个任务
+
+	// 提示词优化，生成前使用聊天模型将提示词扩写并翻译为英文
+	PromptEnhance      bool   `yaml:"prompt_enhance" json:"prompt_enhance"`
+	PromptEnhanceModel string `yaml:"prompt_enhance_model" json:"prompt_enhance_model"`
+}
+
+// ContextConfig 上下文窗口配置，对话超出模型上下文窗口时按策略处理历史消息
+type ContextConfig struct {
+	// Policy 超出上下文窗口时的处理方式: drop_oldest, keep_last, summarize, reject, none
+	// 默认 none，裁剪历史消息会改变对话内容，需要显式开启
+	Policy        string         `yaml:"policy" json:"policy"`
+	KeepLast      int            `yaml:"keep_last" json:"keep_last"`           // keep_last 策略保留的最近消息数
+	SummaryModel  string         `yaml:"summary_model" json:"summary_model"`   // summarize 策略用于总结历史消息的模型
+	ModelWindows  map[string]int `yaml:"model_windows" json:"model_windows"`   // 按模型覆盖内置的上下文窗口大小（token）
+	DefaultWindow int            `yaml:"default_window" json:"default_window"` // 未知模型的上下文窗口大小
+	ReserveTokens int            `yaml:"reserve_tokens" json:"reserve_tokens"` // 为模型输出预留的 token 数，请求的 max_tokens 更大时以其为准
+}
+
+// 上下文超限处理策略
+const (
+	ContextPolicyDropOldest = "drop_oldest" // 从最早的消息开始丢弃
+	ContextPolicyKeepLast   = "keep_last"   // 只保留 system 消息和最近 N 条消息
+	ContextPolicySummarize  = "summarize"   // 将较早的消息总结为一段摘要
+	ContextPolicyReject     = "reject"      // 返回 context_length_exceeded 错误
+	ContextPolicyNone       = "none"        // 不检查，原样发送
+)
+
+// MetricsConfig Prometheus 监控指标配置
+type MetricsConfig struct {
+	Enabled     bool   `yaml:"enabled" json:"enabled"`
+	Path        string `yaml:"path" json:"path"`
+	RequireAuth bool   `yaml:"require_auth" json:"require_auth"` // 抓取指标是否需要 Bearer Token
+}
+
+// TracingConfig OpenTelemetry 链路追踪配置，通过 OTLP/HTTP 导出
+type TracingConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Endpoint OTLP/HTTP 地址，如 https://collector:4318 或 localhost:4318，为空时读取 OTEL_EXPORTER_OTLP_* 环境变量
+	Endpoint string `yaml:"endpoint" json:"endpoint"`
+	// Insecure 使用明文 HTTP 导出，只有设置后 host:port 形式的地址才不使用 TLS
+	Insecure    bool    `yaml:"insecure" json:"insecure"`
+	ServiceName string  `yaml:"service_name" json:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio" json:"sample_ratio"` // 没有上游 trace context 时的采样比例
+}
+
+// HealthConfig 健康检查配置
+type HealthConfig struct {
+	// ProbeUpstream /readyz 是否请求 Monica 检查账号是否可用，结果在 ProbeTTL 内复用
+	ProbeUpstream bool          `yaml:"probe_upstream" json:"probe_upstream"`
+	ProbeTTL      time.Duration `yaml:"probe_ttl" json:"probe_ttl"`
+	ProbeTimeout  time.Duration `yaml:"probe_timeout" json:"probe_timeout"`
+}
+
+// AuditConfig 审计日志配置，记录请求的提示词、转换后的 Monica 请求和返回的内容
+type AuditConfig struct {
+	Enabled bool          `yaml:"enabled" json:"enabled"`
+	File    LogFileConfig `yaml:"file" json:"file"`
+	// SampleRate 记录的请求比例 (0-1)
+	SampleRate float64 `yaml:"sample_rate" json:"sample_rate"`
+	// MaxBodyBytes 单个请求或响应记录的最大字节数，超出部分截断，0 表示不限制
+	MaxBodyBytes    int  `yaml:"max_body_bytes" json:"max_body_bytes"`
+	CaptureRequest  bool `yaml:"capture_request" json:"capture_request"`   // 记录客户端请求
+	CaptureUpstream bool `yaml:"capture_upstream" json:"capture_upstream"` // 记录发送给 Monica 的请求
+	CaptureResponse bool `yaml:"capture_response" json:"capture_response"` // 记录响应和流式输出的文本
+	// RedactFields 审计记录中额外需要隐藏的 JSON 字段名
+	RedactFields []string `yaml:"redact_fields" json:"redact_fields"`
+	// ExcludeKeys 不记录审计日志的 API Key
+	ExcludeKeys []string `yaml:"exclude_keys" json:"exclude_keys"`
+}
+
+// DebugConfig 调试配置
+type DebugConfig struct {
+	// CaptureSSE 将 Monica 返回的原始 SSE 数据保存到 CaptureDir，用于 replay 命令离线重放
+	// 捕获文件包含完整的对话内容，只应在排查问题时临时启用
+	CaptureSSE bool   `yaml:"capture_sse" json:"capture_sse"`
+	CaptureDir string `yaml:"capture_dir" json:"capture_dir"`
+}
+
+// AdminConfig 管理接口配置，管理接口可以查看配置和正在处理的请求、修改日志级别和取消请求
+type AdminConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Token 管理接口使用的 Bearer Token，必须与 API 的 BEARER_TOKEN 不同
+	Token string `yaml:"token" json:"token"`
 }
 
 // Load 加载配置，优先级：配置文件 > 环境变量 > 默认值
@@ -115,11 +320,15 @@ func getDefaultConfig() *Config {
 			IdleTimeout:  60 * time.Second,
 		},
 		Monica: MonicaConfig{
-			Cookie:              "",
-			BotUID:              "",
-			EnableCustomBotMode: false,
-			DefaultLocale:       "ru_RU",
-			DefaultAIRespLang:   "Russian",
+			Cookie:                   "",
+			BotUID:                   "",
+			EnableCustomBotMode:      false,
+			DefaultLocale:            "ru_RU",
+			DefaultAIRespLang:        "Russian",
+			SystemPromptStrategy:     SystemPromptPrepend,
+			ImageUploadFailurePolicy: ImageUploadFailureSkip,
+			MaxChoices:               4,
+			BaseURL:                  "https://api.monica.im",
 		},
 		Security: SecurityConfig{
 			TLSSkipVerify:    true,
@@ -137,12 +346,110 @@ func getDefaultConfig() *Config {
 			RetryMaxWaitTime:    10 * time.Second,
 		},
 		Logging: LoggingConfig{
-			Level:            "info",
-			Format:           "json",
-			Output:           "stdout",
+			Level:  "info",
+			Format: LogFormatJSON,
+			Output: LogOutputStdout,
+			File: LogFileConfig{
+				Path:       "logs/monica-proxy.log",
+				MaxSize:    100,
+				MaxAge:     7,
+				MaxBackups: 10,
+				Compress:   true,
+			},
+			AccessFile: LogFileConfig{
+				Path:       "logs/access.log",
+				MaxSize:    100,
+				MaxAge:     7,
+				MaxBackups: 10,
+				Compress:   true,
+			},
 			EnableRequestLog: true,
 			MaskSensitive:    true,
 		},
+		Upload: UploadConfig{
+			RemoteFetchEnabled:      true,
+			RemoteFetchTimeout:      15 * time.Second,
+			RemoteFetchMaxSize:      10 * 1024 * 1024,
+			RemoteFetchMaxRedirects: 3,
+			RemoteFetchAllowPrivate: false, // 默认禁止访问内网地址，防止SSRF
+			FileStorePath:           "data/files.json",
+			CacheMaxEntries:         10000,
+			CacheMaxBytes:           32 * 1024 * 1024,
+			CacheTTL:                24 * time.Hour,
+			CachePath:               "",
+			ImagePreprocess:         true,
+			ImageMaxDimension:       2048,
+			ImageLowDetailDimension: 512,
+			ImageMaxPixels:          50_000_000,
+			ImageJPEGQuality:        85,
+			ImageStripMetadata:      true,
+		},
+		Image: ImageConfig{
+			ProxyEnabled:   false,
+			StoreDir:       "data/images",
+			StoreTTL:       7 * 24 * time.Hour,
+			PublicBaseURL:  "",
+			JobWorkers:     4,
+			JobQueueSize:   100,
+			JobTimeout:     10 * time.Minute,
+			JobTTL:         24 * time.Hour,
+			WebhookTimeout: 10 * time.Second,
+			ModelTypes: map[string]string{
+				"dall-e-2":    "sdxl",
+				"dall-e-3":    "sdxl",
+				"gpt-image-1": "sdxl",
+			},
+			DefaultModelType:   "sdxl",
+			MaxImagesPerCall:   4,
+			PromptEnhance:      false,
+			PromptEnhanceModel: "gpt-4o-mini",
+		},
+		Context: ContextConfig{
+			Policy:        ContextPolicyNone,
+			KeepLast:      10,
+			SummaryModel:  "gpt-4o-mini",
+			DefaultWindow: 128000,
+			ReserveTokens: 4096,
+		},
+		Metrics: MetricsConfig{
+			Enabled:     true,
+			Path:        "/metrics",
+			RequireAuth: true,
+		},
+		Tracing: TracingConfig{
+			Enabled:     false,
+			Endpoint:    "",
+			Insecure:    false,
+			ServiceName: "monica-proxy",
+			SampleRatio: 1.0,
+		},
+		Health: HealthConfig{
+			ProbeUpstream: false,
+			ProbeTTL:      60 * time.Second,
+			ProbeTimeout:  10 * time.Second,
+		},
+		Audit: AuditConfig{
+			Enabled: false,
+			File: LogFileConfig{
+				Path:       "logs/audit.jsonl",
+				MaxSize:    100,
+				MaxAge:     30,
+				MaxBackups: 30,
+				Compress:   true,
+			},
+			SampleRate:      1.0,
+			MaxBodyBytes:    64 * 1024,
+			CaptureRequest:  true,
+			CaptureUpstream: true,
+			CaptureResponse: true,
+		},
+		Debug: DebugConfig{
+			CaptureSSE: false,
+			CaptureDir: "captures",
+		},
+		Admin: AdminConfig{
+			Enabled: false,
+		},
 	}
 }
 
@@ -222,6 +529,9 @@ func overrideWithEnv(config *Config) {
 	if cookie := os.Getenv("MONICA_COOKIE"); cookie != "" {
 		config.Monica.Cookie = cookie
 	}
+	if baseURL := os.Getenv("MONICA_BASE_URL"); baseURL != "" {
+		config.Monica.BaseURL = baseURL
+	}
 	if botUID := os.Getenv("BOT_UID"); botUID != "" {
 		config.Monica.BotUID = botUID
 	}
@@ -236,6 +546,17 @@ func overrideWithEnv(config *Config) {
 	if defaultAIRespLang := os.Getenv("MONICA_DEFAULT_AI_RESP_LANGUAGE"); defaultAIRespLang != "" {
 		config.Monica.DefaultAIRespLang = defaultAIRespLang
 	}
+	if strategy := os.Getenv("SYSTEM_PROMPT_STRATEGY"); strategy != "" {
+		config.Monica.SystemPromptStrategy = strategy
+	}
+	if policy := os.Getenv("IMAGE_UPLOAD_FAILURE_POLICY"); policy != "" {
+		config.Monica.ImageUploadFailurePolicy = policy
+	}
+	if maxChoices := os.Getenv("MAX_CHOICES"); maxChoices != "" {
+		if n, err := strconv.Atoi(maxChoices); err == nil {
+			config.Monica.MaxChoices = n
+		}
+	}
 
 	// 安全配置
 	if token := os.Getenv("BEARER_TOKEN"); token != "" {
@@ -264,6 +585,294 @@ func overrideWithEnv(config *Config) {
 	if format := os.Getenv("LOG_FORMAT"); format != "" {
 		config.Logging.Format = format
 	}
+	if output := os.Getenv("LOG_OUTPUT"); output != "" {
+		config.Logging.Output = output
+	}
+	if path := os.Getenv("LOG_FILE"); path != "" {
+		config.Logging.File.Path = path
+	}
+	if mask := os.Getenv("LOG_MASK_SENSITIVE"); mask != "" {
+		if m, err := strconv.ParseBool(mask); err == nil {
+			config.Logging.MaskSensitive = m
+		}
+	}
+	if fields := os.Getenv("LOG_REDACT_FIELDS"); fields != "" {
+		config.Logging.RedactFields = strings.Split(fields, ",")
+	}
+	if output := os.Getenv("LOG_ACCESS_OUTPUT"); output != "" {
+		config.Logging.AccessOutput = output
+	}
+	if path := os.Getenv("LOG_ACCESS_FILE"); path != "" {
+		config.Logging.AccessFile.Path = path
+	}
+	// 轮转配置同时作用于应用日志和请求日志文件
+	if maxSize := os.Getenv("LOG_MAX_SIZE"); maxSize != "" {
+		if size, err := strconv.Atoi(maxSize); err == nil {
+			config.Logging.File.MaxSize = size
+			config.Logging.AccessFile.MaxSize = size
+		}
+	}
+	if maxAge := os.Getenv("LOG_MAX_AGE"); maxAge != "" {
+		if age, err := strconv.Atoi(maxAge); err == nil {
+			config.Logging.File.MaxAge = age
+			config.Logging.AccessFile.MaxAge = age
+		}
+	}
+	if maxBackups := os.Getenv("LOG_MAX_BACKUPS"); maxBackups != "" {
+		if backups, err := strconv.Atoi(maxBackups); err == nil {
+			config.Logging.File.MaxBackups = backups
+			config.Logging.AccessFile.MaxBackups = backups
+		}
+	}
+	if compress := os.Getenv("LOG_COMPRESS"); compress != "" {
+		if c, err := strconv.ParseBool(compress); err == nil {
+			config.Logging.File.Compress = c
+			config.Logging.AccessFile.Compress = c
+		}
+	}
+
+	// 文件上传配置
+	if enabled := os.Getenv("REMOTE_FETCH_ENABLED"); enabled != "" {
+		if e, err := strconv.ParseBool(enabled); err == nil {
+			config.Upload.RemoteFetchEnabled = e
+		}
+	}
+	if timeout := os.Getenv("REMOTE_FETCH_TIMEOUT"); timeout != "" {
+		if t, err := time.ParseDuration(timeout); err == nil {
+			config.Upload.RemoteFetchTimeout = t
+		}
+	}
+	if maxSize := os.Getenv("REMOTE_FETCH_MAX_SIZE"); maxSize != "" {
+		if size, err := strconv.ParseInt(maxSize, 10, 64); err == nil {
+			config.Upload.RemoteFetchMaxSize = size
+		}
+	}
+	if allowPrivate := os.Getenv("REMOTE_FETCH_ALLOW_PRIVATE"); allowPrivate != "" {
+		if allow, err := strconv.ParseBool(allowPrivate); err == nil {
+			config.Upload.RemoteFetchAllowPrivate = allow
+		}
+	}
+	if path, ok := os.LookupEnv("FILE_STORE_PATH"); ok {
+		config.Upload.FileStorePath = path
+	}
+	if maxEntries := os.Getenv("UPLOAD_CACHE_MAX_ENTRIES"); maxEntries != "" {
+		if n, err := strconv.Atoi(maxEntries); err == nil {
+			config.Upload.CacheMaxEntries = n
+		}
+	}
+	if ttl := os.Getenv("UPLOAD_CACHE_TTL"); ttl != "" {
+		if t, err := time.ParseDuration(ttl); err == nil {
+			config.Upload.CacheTTL = t
+		}
+	}
+	if path := os.Getenv("UPLOAD_CACHE_PATH"); path != "" {
+		config.Upload.CachePath = path
+	}
+	if preprocess := os.Getenv("IMAGE_PREPROCESS"); preprocess != "" {
+		if p, err := strconv.ParseBool(preprocess); err == nil {
+			config.Upload.ImagePreprocess = p
+		}
+	}
+	if maxDimension := os.Getenv("IMAGE_MAX_DIMENSION"); maxDimension != "" {
+		if n, err := strconv.Atoi(maxDimension); err == nil {
+			config.Upload.ImageMaxDimension = n
+		}
+	}
+	if maxPixels := os.Getenv("IMAGE_MAX_PIXELS"); maxPixels != "" {
+		if n, err := strconv.ParseInt(maxPixels, 10, 64); err == nil {
+			config.Upload.ImageMaxPixels = n
+		}
+	}
+	if quality := os.Getenv("IMAGE_JPEG_QUALITY"); quality != "" {
+		if q, err := strconv.Atoi(quality); err == nil {
+			config.Upload.ImageJPEGQuality = q
+		}
+	}
+	if strip := os.Getenv("IMAGE_STRIP_METADATA"); strip != "" {
+		if s, err := strconv.ParseBool(strip); err == nil {
+			config.Upload.ImageStripMetadata = s
+		}
+	}
+
+	// 图片生成配置
+	if enabled := os.Getenv("IMAGE_PROXY_ENABLED"); enabled != "" {
+		if e, err := strconv.ParseBool(enabled); err == nil {
+			config.Image.ProxyEnabled = e
+		}
+	}
+	if dir := os.Getenv("IMAGE_STORE_DIR"); dir != "" {
+		config.Image.StoreDir = dir
+	}
+	if ttl := os.Getenv("IMAGE_STORE_TTL"); ttl != "" {
+		if t, err := time.ParseDuration(ttl); err == nil {
+			config.Image.StoreTTL = t
+		}
+	}
+	if baseURL := os.Getenv("IMAGE_PUBLIC_BASE_URL"); baseURL != "" {
+		config.Image.PublicBaseURL = baseURL
+	}
+	if workers := os.Getenv("IMAGE_JOB_WORKERS"); workers != "" {
+		if n, err := strconv.Atoi(workers); err == nil {
+			config.Image.JobWorkers = n
+		}
+	}
+	if queueSize := os.Getenv("IMAGE_JOB_QUEUE_SIZE"); queueSize != "" {
+		if n, err := strconv.Atoi(queueSize); err == nil {
+			config.Image.JobQueueSize = n
+		}
+	}
+	if modelType := os.Getenv("IMAGE_DEFAULT_MODEL_TYPE"); modelType != "" {
+		config.Image.DefaultModelType = modelType
+	}
+	if maxImages := os.Getenv("IMAGE_MAX_PER_CALL"); maxImages != "" {
+		if n, err := strconv.Atoi(maxImages); err == nil {
+			config.Image.MaxImagesPerCall = n
+		}
+	}
+	if enhance := os.Getenv("IMAGE_PROMPT_ENHANCE"); enhance != "" {
+		if e, err := strconv.ParseBool(enhance); err == nil {
+			config.Image.PromptEnhance = e
+		}
+	}
+	if model := os.Getenv("IMAGE_PROMPT_ENHANCE_MODEL"); model != "" {
+		config.Image.PromptEnhanceModel = model
+	}
+
+	// 上下文窗口配置
+	if policy := os.Getenv("CONTEXT_POLICY"); policy != "" {
+		config.Context.Policy = policy
+	}
+	if keepLast := os.Getenv("CONTEXT_KEEP_LAST"); keepLast != "" {
+		if n, err := strconv.Atoi(keepLast); err == nil {
+			config.Context.KeepLast = n
+		}
+	}
+	if model := os.Getenv("CONTEXT_SUMMARY_MODEL"); model != "" {
+		config.Context.SummaryModel = model
+	}
+	if window := os.Getenv("CONTEXT_DEFAULT_WINDOW"); window != "" {
+		if n, err := strconv.Atoi(window); err == nil {
+			config.Context.DefaultWindow = n
+		}
+	}
+	if reserve := os.Getenv("CONTEXT_RESERVE_TOKENS"); reserve != "" {
+		if n, err := strconv.Atoi(reserve); err == nil {
+			config.Context.ReserveTokens = n
+		}
+	}
+
+	// 监控指标配置
+	if enabled := os.Getenv("METRICS_ENABLED"); enabled != "" {
+		if e, err := strconv.ParseBool(enabled); err == nil {
+			config.Metrics.Enabled = e
+		}
+	}
+	if path := os.Getenv("METRICS_PATH"); path != "" {
+		config.Metrics.Path = path
+	}
+	if requireAuth := os.Getenv("METRICS_REQUIRE_AUTH"); requireAuth != "" {
+		if r, err := strconv.ParseBool(requireAuth); err == nil {
+			config.Metrics.RequireAuth = r
+		}
+	}
+
+	// 链路追踪配置
+	if enabled := os.Getenv("TRACING_ENABLED"); enabled != "" {
+		if e, err := strconv.ParseBool(enabled); err == nil {
+			config.Tracing.Enabled = e
+		}
+	}
+	if endpoint := os.Getenv("TRACING_ENDPOINT"); endpoint != "" {
+		config.Tracing.Endpoint = endpoint
+	}
+	if insecure := os.Getenv("TRACING_INSECURE"); insecure != "" {
+		if i, err := strconv.ParseBool(insecure); err == nil {
+			config.Tracing.Insecure = i
+		}
+	}
+	if ratio := os.Getenv("TRACING_SAMPLE_RATIO"); ratio != "" {
+		if r, err := strconv.ParseFloat(ratio, 64); err == nil {
+			config.Tracing.SampleRatio = r
+		}
+	}
+
+	// 健康检查配置
+	if probe := os.Getenv("HEALTH_PROBE_UPSTREAM"); probe != "" {
+		if p, err := strconv.ParseBool(probe); err == nil {
+			config.Health.ProbeUpstream = p
+		}
+	}
+	if ttl := os.Getenv("HEALTH_PROBE_TTL"); ttl != "" {
+		if t, err := time.ParseDuration(ttl); err == nil {
+			config.Health.ProbeTTL = t
+		}
+	}
+	if timeout := os.Getenv("HEALTH_PROBE_TIMEOUT"); timeout != "" {
+		if t, err := time.ParseDuration(timeout); err == nil {
+			config.Health.ProbeTimeout = t
+		}
+	}
+
+	// 审计日志配置
+	if enabled := os.Getenv("AUDIT_ENABLED"); enabled != "" {
+		if e, err := strconv.ParseBool(enabled); err == nil {
+			config.Audit.Enabled = e
+		}
+	}
+	if path := os.Getenv("AUDIT_FILE"); path != "" {
+		config.Audit.File.Path = path
+	}
+	if rate := os.Getenv("AUDIT_SAMPLE_RATE"); rate != "" {
+		if r, err := strconv.ParseFloat(rate, 64); err == nil {
+			config.Audit.SampleRate = r
+		}
+	}
+	if maxBytes := os.Getenv("AUDIT_MAX_BODY_BYTES"); maxBytes != "" {
+		if n, err := strconv.Atoi(maxBytes); err == nil {
+			config.Audit.MaxBodyBytes = n
+		}
+	}
+	if capture := os.Getenv("AUDIT_CAPTURE_REQUEST"); capture != "" {
+		if c, err := strconv.ParseBool(capture); err == nil {
+			config.Audit.CaptureRequest = c
+		}
+	}
+	if capture := os.Getenv("AUDIT_CAPTURE_UPSTREAM"); capture != "" {
+		if c, err := strconv.ParseBool(capture); err == nil {
+			config.Audit.CaptureUpstream = c
+		}
+	}
+	if capture := os.Getenv("AUDIT_CAPTURE_RESPONSE"); capture != "" {
+		if c, err := strconv.ParseBool(capture); err == nil {
+			config.Audit.CaptureResponse = c
+		}
+	}
+	if fields := os.Getenv("AUDIT_REDACT_FIELDS"); fields != "" {
+		config.Audit.RedactFields = strings.Split(fields, ",")
+	}
+	if keys := os.Getenv("AUDIT_EXCLUDE_KEYS"); keys != "" {
+		config.Audit.ExcludeKeys = strings.Split(keys, ",")
+	}
+
+	// 调试配置
+	if capture := os.Getenv("SSE_CAPTURE_ENABLED"); capture != "" {
+		if c, err := strconv.ParseBool(capture); err == nil {
+			config.Debug.CaptureSSE = c
+		}
+	}
+	if dir := os.Getenv("SSE_CAPTURE_DIR"); dir != "" {
+		config.Debug.CaptureDir = dir
+	}
+
+	// 管理接口配置
+	if enabled := os.Getenv("ADMIN_ENABLED"); enabled != "" {
+		if e, err := strconv.ParseBool(enabled); err == nil {
+			config.Admin.Enabled = e
+		}
+	}
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+		config.Admin.Token = token
+	}
 }
 
 // Validate 验证配置
@@ -274,6 +883,9 @@ func (c *Config) Validate() error {
 	if c.Monica.Cookie == "" {
 		errors = append(errors, "MONICA_COOKIE is required")
 	}
+	if u, err := url.Parse(c.Monica.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errors = append(errors, "MONICA_BASE_URL must be an http(s) URL")
+	}
 	if c.Security.BearerToken == "" {
 		errors = append(errors, "BEARER_TOKEN is required")
 	}
@@ -283,6 +895,21 @@ func (c *Config) Validate() error {
 		errors = append(errors, "BOT_UID is required when ENABLE_CUSTOM_BOT_MODE is true")
 	}
 
+	// 验证 system prompt 策略
+	validStrategies := []string{SystemPromptPrepend, SystemPromptPair, SystemPromptInject, SystemPromptNone}
+	if !contains(validStrategies, c.Monica.SystemPromptStrategy) {
+		errors = append(errors, fmt.Sprintf("SYSTEM_PROMPT_STRATEGY must be one of: %s", strings.Join(validStrategies, ", ")))
+	}
+
+	// 验证图片上传失败策略
+	validPolicies := []string{ImageUploadFailureSkip, ImageUploadFailureFail}
+	if !contains(validPolicies, c.Monica.ImageUploadFailurePolicy) {
+		errors = append(errors, fmt.Sprintf("IMAGE_UPLOAD_FAILURE_POLICY must be one of: %s", strings.Join(validPolicies, ", ")))
+	}
+	if c.Monica.MaxChoices <= 0 {
+		errors = append(errors, "MAX_CHOICES must be greater than 0")
+	}
+
 	// 验证端口范围
 	if c.Server.Port < 1 || c.Server.Port > 65535 {
 		errors = append(errors, "SERVER_PORT must be between 1 and 65535")
@@ -296,6 +923,133 @@ func (c *Config) Validate() error {
 		errors = append(errors, "HTTP_CLIENT_TIMEOUT must be positive")
 	}
 
+	// 验证远程文件下载配置
+	if c.Upload.RemoteFetchEnabled {
+		if c.Upload.RemoteFetchTimeout <= 0 {
+			errors = append(errors, "REMOTE_FETCH_TIMEOUT must be positive")
+		}
+		if c.Upload.RemoteFetchMaxSize <= 0 {
+			errors = append(errors, "REMOTE_FETCH_MAX_SIZE must be positive")
+		}
+		if c.Upload.RemoteFetchMaxRedirects < 0 {
+			errors = append(errors, "remote_fetch_max_redirects must not be negative")
+		}
+	}
+
+	// 验证上传缓存配置
+	if c.Upload.CacheMaxEntries < 0 || c.Upload.CacheMaxBytes < 0 {
+		errors = append(errors, "upload cache limits must not be negative")
+	}
+	if c.Upload.CacheTTL < 0 {
+		errors = append(errors, "UPLOAD_CACHE_TTL must be positive")
+	}
+
+	// 验证图片预处理配置
+	if c.Upload.ImagePreprocess {
+		if c.Upload.ImageMaxDimension <= 0 || c.Upload.ImageLowDetailDimension <= 0 {
+			errors = append(errors, "IMAGE_MAX_DIMENSION must be positive")
+		}
+		if c.Upload.ImageMaxPixels <= 0 {
+			errors = append(errors, "IMAGE_MAX_PIXELS must be positive")
+		}
+		if c.Upload.ImageJPEGQuality < 1 || c.Upload.ImageJPEGQuality > 100 {
+			errors = append(errors, "IMAGE_JPEG_QUALITY must be between 1 and 100")
+		}
+	}
+
+	// 验证图片代理配置
+	if c.Image.ProxyEnabled {
+		if c.Image.StoreDir == "" {
+			errors = append(errors, "IMAGE_STORE_DIR is required when image proxy is enabled")
+		}
+		if c.Image.StoreTTL < 0 {
+			errors = append(errors, "IMAGE_STORE_TTL must not be negative")
+		}
+		if u, err := url.Parse(c.Image.PublicBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errors = append(errors, "IMAGE_PUBLIC_BASE_URL must be an http(s) URL when image proxy is enabled")
+		}
+	}
+
+	// 验证异步图片任务配置
+	if c.Image.JobWorkers <= 0 {
+		errors = append(errors, "IMAGE_JOB_WORKERS must be positive")
+	}
+	if c.Image.JobQueueSize <= 0 {
+		errors = append(errors, "IMAGE_JOB_QUEUE_SIZE must be positive")
+	}
+	if c.Image.JobTimeout <= 0 || c.Image.JobTTL <= 0 || c.Image.WebhookTimeout <= 0 {
+		errors = append(errors, "image job timeouts must be positive")
+	}
+	if c.Image.DefaultModelType == "" {
+		errors = append(errors, "IMAGE_DEFAULT_MODEL_TYPE is required")
+	}
+	if c.Image.MaxImagesPerCall <= 0 {
+		errors = append(errors, "IMAGE_MAX_PER_CALL must be positive")
+	}
+	if c.Image.PromptEnhance && c.Image.PromptEnhanceModel == "" {
+		errors = append(errors, "IMAGE_PROMPT_ENHANCE_MODEL is required when prompt enhancement is enabled")
+	}
+
+	// 验证上下文窗口配置
+	validContextPolicies := []string{ContextPolicyDropOldest, ContextPolicyKeepLast, ContextPolicySummarize, ContextPolicyReject, ContextPolicyNone}
+	if !contains(validContextPolicies, c.Context.Policy) {
+		errors = append(errors, fmt.Sprintf("CONTEXT_POLICY must be one of: %s", strings.Join(validContextPolicies, ", ")))
+	}
+	if c.Context.KeepLast <= 0 {
+		errors = append(errors, "CONTEXT_KEEP_LAST must be positive")
+	}
+	if c.Context.Policy == ContextPolicySummarize && c.Context.SummaryModel == "" {
+		errors = append(errors, "CONTEXT_SUMMARY_MODEL is required when CONTEXT_POLICY is summarize")
+	}
+	if c.Context.DefaultWindow <= 0 || c.Context.ReserveTokens < 0 {
+		errors = append(errors, "CONTEXT_DEFAULT_WINDOW must be positive and CONTEXT_RESERVE_TOKENS must not be negative")
+	}
+
+	// 验证监控指标配置
+	if c.Metrics.Enabled && !strings.HasPrefix(c.Metrics.Path, "/") {
+		errors = append(errors, "METRICS_PATH must start with /")
+	}
+
+	// 验证链路追踪配置
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errors = append(errors, "TRACING_SAMPLE_RATIO must be between 0 and 1")
+	}
+	if c.Tracing.Insecure && strings.HasPrefix(c.Tracing.Endpoint, "https://") {
+		errors = append(errors, "TRACING_INSECURE conflicts with an https TRACING_ENDPOINT")
+	}
+
+	// 验证审计日志配置
+	if c.Audit.Enabled {
+		if c.Audit.File.Path == "" {
+			errors = append(errors, "AUDIT_FILE is required when audit is enabled")
+		}
+		if c.Audit.SampleRate < 0 || c.Audit.SampleRate > 1 {
+			errors = append(errors, "AUDIT_SAMPLE_RATE must be between 0 and 1")
+		}
+		if c.Audit.MaxBodyBytes < 0 {
+			errors = append(errors, "AUDIT_MAX_BODY_BYTES must not be negative")
+		}
+	}
+
+	// 验证调试配置
+	if c.Debug.CaptureSSE && c.Debug.CaptureDir == "" {
+		errors = append(errors, "SSE_CAPTURE_DIR is required when SSE capture is enabled")
+	}
+
+	// 验证管理接口配置
+	if c.Admin.Enabled {
+		if c.Admin.Token == "" {
+			errors = append(errors, "ADMIN_TOKEN is required when admin API is enabled")
+		} else if c.Admin.Token == c.Security.BearerToken {
+			errors = append(errors, "ADMIN_TOKEN must differ from BEARER_TOKEN")
+		}
+	}
+
+	// 验证健康检查配置
+	if c.Health.ProbeUpstream && c.Health.ProbeTimeout <= 0 {
+		errors = append(errors, "HEALTH_PROBE_TIMEOUT must be positive when upstream probe is enabled")
+	}
+
 	// 验证限流配置
 	if c.Security.RateLimitRPS <= 0 {
 		// 如果RPS<=0，自动禁用限流
@@ -314,6 +1068,24 @@ func (c *Config) Validate() error {
 		errors = append(errors, fmt.Sprintf("LOG_LEVEL must be one of: %s", strings.Join(validLevels, ", ")))
 	}
 
+	// 验证日志格式和输出
+	if !contains([]string{LogFormatJSON, LogFormatConsole}, c.Logging.Format) {
+		errors = append(errors, "LOG_FORMAT must be one of: json, console")
+	}
+	validOutputs := []string{LogOutputStdout, LogOutputStderr, LogOutputFile}
+	if !contains(validOutputs, c.Logging.Output) {
+		errors = append(errors, "LOG_OUTPUT must be one of: stdout, stderr, file")
+	}
+	if c.Logging.AccessOutput != "" && !contains(validOutputs, c.Logging.AccessOutput) {
+		errors = append(errors, "LOG_ACCESS_OUTPUT must be one of: stdout, stderr, file")
+	}
+	if c.Logging.Output == LogOutputFile && c.Logging.File.Path == "" {
+		errors = append(errors, "LOG_FILE is required when LOG_OUTPUT is file")
+	}
+	if c.Logging.AccessOutput == LogOutputFile && c.Logging.AccessFile.Path == "" {
+		errors = append(errors, "LOG_ACCESS_FILE is required when LOG_ACCESS_OUTPUT is file")
+	}
+
 	if len(errors) > 0 {
 		return fmt.Errorf("%s", strings.Join(errors, "; "))
 	}
@@ -25,14 +25,32 @@ const (
 	ErrImageGeneration
 	ErrModelMapping
 	ErrFileUpload
+	ErrServiceBusy
+	ErrContextLengthExceeded
+	ErrRequestCancelled
 )
 
+// StatusClientClosedRequest 请求被取消时的HTTP状态码，与 nginx 的 499 含义一致
+const StatusClientClosedRequest = 499
+
 // AppError 应用错误
 type AppError struct {
 	Code    ErrorCode // 错误码
 	Message string    // 错误消息
 	Err     error     // 原始错误
 	Status  int       // HTTP状态码
+
+	// OpenAICode OpenAI 兼容的错误代码（如 context_length_exceeded），设置后代替数字错误码返回给客户端
+	OpenAICode string
+	Param      string // 导致错误的请求参数
+}
+
+// ResponseCode 返回给客户端的错误代码
+func (e *AppError) ResponseCode() any {
+	if e.OpenAICode != "" {
+		return e.OpenAICode
+	}
+	return e.Code
 }
 
 // Error 实现error接口
@@ -52,7 +70,7 @@ func (e *AppError) Unwrap() error {
 func (e *AppError) HTTPResponse() (int, map[string]interface{}) {
 	return e.Status, map[string]interface{}{
 		"error": map[string]interface{}{
-			"code":    e.Code,
+			"code":    e.ResponseCode(),
 			"message": e.Message,
 		},
 	}
@@ -87,6 +105,45 @@ func NewUnauthorizedError(message string) *AppError {
 	}
 }
 
+// NewNotFoundError 创建资源不存在错误
+func NewNotFoundError(message string) *AppError {
+	return &AppError{
+		Code:    ErrNotFound,
+		Message: message,
+		Status:  http.StatusNotFound,
+	}
+}
+
+// NewServiceBusyError 创建服务繁忙错误
+func NewServiceBusyError(message string) *AppError {
+	return &AppError{
+		Code:    ErrServiceBusy,
+		Message: message,
+		Status:  http.StatusServiceUnavailable,
+	}
+}
+
+// NewContextLengthExceededError 创建上下文超限错误，与 OpenAI 的错误代码保持一致
+func NewContextLengthExceededError(tokens, limit int) *AppError {
+	return &AppError{
+		Code:       ErrContextLengthExceeded,
+		Message:    fmt.Sprintf("This model's maximum context length is %d tokens. However, your messages resulted in about %d tokens. Please reduce the length of the messages.", limit, tokens),
+		Status:     http.StatusBadRequest,
+		OpenAICode: "context_length_exceeded",
+		Param:      "messages",
+	}
+}
+
+// NewRequestCancelledError 创建请求被取消的错误
+func NewRequestCancelledError(err error) *AppError {
+	return &AppError{
+		Code:    ErrRequestCancelled,
+		Message: "请求已取消",
+		Err:     err,
+		Status:  StatusClientClosedRequest,
+	}
+}
+
 // NewInvalidInputError 创建无效输入错误
 func NewInvalidInputError(message string, err error) *AppError {
 	return &AppError{
@@ -144,3 +201,12 @@ func NewFileUploadError(err error) *AppError {
 		Status:  http.StatusInternalServerError,
 	}
 }
+
+// NewFileParseError 创建文件解析错误，将 Monica 返回的失败原因透传给客户端
+func NewFileParseError(fileName, reason string) *AppError {
+	return &AppError{
+		Code:    ErrFileUpload,
+		Message: fmt.Sprintf("文件解析失败: %s: %s", fileName, reason),
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
@@ -0,0 +1,149 @@
+package inflight
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCancelled 请求被主动取消时 context 的 cause，用于区分客户端断开和超时
+var ErrCancelled = errors.New("request cancelled")
+
+// ErrDuplicateID 请求ID已被正在处理的请求占用
+var ErrDuplicateID = errors.New("duplicate request id")
+
+// Request 正在处理的请求
+type Request struct {
+	ID        string
+	Method    string
+	Path      string
+	APIKey    string
+	StartedAt time.Time
+
+	mu     sync.Mutex
+	model  string
+	cancel context.CancelCauseFunc
+}
+
+// Info 请求的快照，用于管理接口展示
+type Info struct {
+	ID        string    `json:"id"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Model     string    `json:"model,omitempty"`
+	APIKey    string    `json:"api_key"`
+	StartedAt time.Time `json:"started_at"`
+	ElapsedMs int64     `json:"elapsed_ms"`
+}
+
+// SetModel 记录请求使用的模型，未跟踪的请求为 nil 时忽略
+func (r *Request) SetModel(model string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.model = model
+	r.mu.Unlock()
+}
+
+// info 生成请求的快照
+func (r *Request) info(now time.Time) Info {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Info{
+		ID:        r.ID,
+		Method:    r.Method,
+		Path:      r.Path,
+		Model:     r.model,
+		APIKey:    r.APIKey,
+		StartedAt: r.StartedAt,
+		ElapsedMs: now.Sub(r.StartedAt).Milliseconds(),
+	}
+}
+
+// Registry 按请求ID记录正在处理的请求，可以取消请求的 context
+type Registry struct {
+	mu       sync.RWMutex
+	requests map[string]*Request
+}
+
+// NewRegistry 创建请求登记表
+func NewRegistry() *Registry {
+	return &Registry{requests: make(map[string]*Request)}
+}
+
+// Start 登记请求，返回可被取消的 context 和请求结束时调用的函数
+// 客户端可以自行指定 X-Request-Id，ID 已被正在处理的请求占用时返回 ErrDuplicateID，不覆盖之前的登记
+func (r *Registry) Start(ctx context.Context, req *Request) (context.Context, func(), error) {
+	r.mu.Lock()
+	if _, ok := r.requests[req.ID]; ok {
+		r.mu.Unlock()
+		return ctx, nil, ErrDuplicateID
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	req.cancel = cancel
+	if req.StartedAt.IsZero() {
+		req.StartedAt = time.Now()
+	}
+	r.requests[req.ID] = req
+	r.mu.Unlock()
+
+	done := func() {
+		r.mu.Lock()
+		if r.requests[req.ID] == req {
+			delete(r.requests, req.ID)
+		}
+		r.mu.Unlock()
+		cancel(nil)
+	}
+	return WithRequest(ctx, req), done, nil
+}
+
+// List 获取正在处理的请求，按开始时间排序
+func (r *Registry) List() []Info {
+	now := time.Now()
+	r.mu.RLock()
+	infos := make([]Info, 0, len(r.requests))
+	for _, req := range r.requests {
+		infos = append(infos, req.info(now))
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].StartedAt.Before(infos[j].StartedAt)
+	})
+	return infos
+}
+
+// Cancel 取消指定请求的 context，返回请求被取消时的快照，请求不存在时返回 false
+func (r *Registry) Cancel(id string) (Info, bool) {
+	r.mu.RLock()
+	req, ok := r.requests[id]
+	r.mu.RUnlock()
+	if !ok {
+		return Info{}, false
+	}
+	req.cancel(ErrCancelled)
+	return req.info(time.Now()), true
+}
+
+// Cancelled 判断 context 是否因为请求被主动取消而结束
+func Cancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrCancelled)
+}
+
+// contextKey context 中保存请求的键
+type contextKey struct{}
+
+// WithRequest 将请求保存到 context
+func WithRequest(ctx context.Context, req *Request) context.Context {
+	return context.WithValue(ctx, contextKey{}, req)
+}
+
+// FromContext 从 context 获取请求，未跟踪时返回 nil
+func FromContext(ctx context.Context) *Request {
+	req, _ := ctx.Value(contextKey{}).(*Request)
+	return req
+}
@@ -0,0 +1,39 @@
+package inflight
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRegistryStartDuplicateID(t *testing.T) {
+	registry := NewRegistry()
+
+	first, done, err := registry.Start(context.Background(), &Request{ID: "req-1", Path: "/v1/chat/completions"})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	if _, _, err := registry.Start(context.Background(), &Request{ID: "req-1", Path: "/v1/images/generations"}); !errors.Is(err, ErrDuplicateID) {
+		t.Fatalf("duplicate Start() error = %v, want ErrDuplicateID", err)
+	}
+
+	// 重复的请求不能覆盖之前的登记，取消操作仍然作用于第一个请求
+	info, ok := registry.Cancel("req-1")
+	if !ok || info.Path != "/v1/chat/completions" {
+		t.Fatalf("Cancel() = %+v, %v, want first request", info, ok)
+	}
+	if !Cancelled(first) {
+		t.Error("first request context not cancelled")
+	}
+
+	done()
+	if got := registry.List(); len(got) != 0 {
+		t.Fatalf("List() after done = %+v, want empty", got)
+	}
+	if _, done, err := registry.Start(context.Background(), &Request{ID: "req-1"}); err != nil {
+		t.Fatalf("Start() after done error = %v", err)
+	} else {
+		done()
+	}
+}
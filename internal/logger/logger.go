@@ -1,11 +1,15 @@
 package logger
 
 import (
+	"fmt"
+	"monica-proxy/internal/config"
 	"os"
+	"path/filepath"
 	"sync"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 var (
@@ -13,18 +17,48 @@ var (
 	logger      *zap.Logger
 	atomicLevel zap.AtomicLevel
 	once        sync.Once
+
+	// accessLogger 请求日志实例，未单独配置输出时与 logger 相同
+	accessLogger *zap.Logger
 )
 
 // 初始化日志
 func init() {
 	once.Do(func() {
 		logger = newLogger()
+		accessLogger = logger
 	})
 }
 
-// newLogger 创建一个新的日志实例
-func newLogger() *zap.Logger {
-	// 创建基础的encoder配置
+// Init 按配置重新创建日志实例，应在启动时、处理请求之前调用
+// 请求日志配置了单独的输出时写入独立的 sink，输出到同一文件时共用同一个轮转写入器
+func Init(cfg config.LoggingConfig) error {
+	atomicLevel.SetLevel(parseLevel(cfg.Level))
+	encoder := newEncoder(cfg.Format)
+
+	sinks := make(map[string]zapcore.WriteSyncer)
+	appSink, err := openSink(cfg.Output, cfg.File, sinks)
+	if err != nil {
+		return err
+	}
+	appLogger := build(zapcore.NewCore(encoder, appSink, atomicLevel))
+
+	reqLogger := appLogger
+	if cfg.AccessOutput != "" {
+		accessSink, err := openSink(cfg.AccessOutput, cfg.AccessFile, sinks)
+		if err != nil {
+			return err
+		}
+		reqLogger = build(zapcore.NewCore(encoder, accessSink, atomicLevel))
+	}
+
+	logger = appLogger
+	accessLogger = reqLogger
+	return nil
+}
+
+// newEncoder 按格式创建 encoder，console 格式便于本地开发时阅读
+func newEncoder(format string) zapcore.Encoder {
 	encoderConfig := zapcore.EncoderConfig{
 		TimeKey:        "time",
 		LevelKey:       "level",
@@ -38,23 +72,73 @@ func newLogger() *zap.Logger {
 		EncodeDuration: zapcore.SecondsDurationEncoder,
 		EncodeCaller:   zapcore.ShortCallerEncoder,
 	}
+	if format == config.LogFormatConsole {
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoderConfig.EncodeDuration = zapcore.StringDurationEncoder
+		return zapcore.NewConsoleEncoder(encoderConfig)
+	}
+	return zapcore.NewJSONEncoder(encoderConfig)
+}
+
+// openSink 打开日志输出，文件输出按大小轮转，按时间和数量清理旧文件
+func openSink(output string, file config.LogFileConfig, sinks map[string]zapcore.WriteSyncer) (zapcore.WriteSyncer, error) {
+	key := output
+	if output == config.LogOutputFile {
+		key = output + ":" + filepath.Clean(file.Path)
+	}
+	if sink, ok := sinks[key]; ok {
+		return sink, nil
+	}
+
+	var sink zapcore.WriteSyncer
+	switch output {
+	case config.LogOutputStdout:
+		sink = zapcore.Lock(os.Stdout)
+	case config.LogOutputStderr:
+		sink = zapcore.Lock(os.Stderr)
+	case config.LogOutputFile:
+		// 提前创建目录，使权限等问题在启动时暴露
+		if err := os.MkdirAll(filepath.Dir(file.Path), 0o755); err != nil {
+			return nil, fmt.Errorf("create log dir failed: %w", err)
+		}
+		sink = zapcore.AddSync(&lumberjack.Logger{
+			Filename:   file.Path,
+			MaxSize:    file.MaxSize,
+			MaxAge:     file.MaxAge,
+			MaxBackups: file.MaxBackups,
+			Compress:   file.Compress,
+			LocalTime:  true,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported log output: %s", output)
+	}
+	sinks[key] = sink
+	return sink, nil
+}
+
+// build 使用统一的选项创建 Logger
+func build(core zapcore.Core) *zap.Logger {
+	return zap.New(core,
+		zap.AddCaller(),
+		zap.AddCallerSkip(1),
+		zap.AddStacktrace(zapcore.ErrorLevel),
+	)
+}
 
+// newLogger 创建默认的日志实例，以 JSON 格式输出到 stdout，Init 之前使用
+func newLogger() *zap.Logger {
 	// 创建AtomicLevel
 	atomicLevel = zap.NewAtomicLevelAt(zap.InfoLevel)
 
 	// 创建Core
 	core := zapcore.NewCore(
-		zapcore.NewJSONEncoder(encoderConfig),
+		newEncoder(config.LogFormatJSON),
 		zapcore.AddSync(os.Stdout),
 		atomicLevel,
 	)
 
 	// 创建Logger
-	return zap.New(core,
-		zap.AddCaller(),
-		zap.AddCallerSkip(1),
-		zap.AddStacktrace(zapcore.ErrorLevel),
-	)
+	return build(core)
 }
 
 // Info 记录INFO级别的日志
@@ -82,6 +166,19 @@ func Fatal(msg string, fields ...zap.Field) {
 	logger.Fatal(msg, fields...)
 }
 
+// Access 记录请求日志，写入请求日志的 sink
+func Access(level zapcore.Level, msg string, fields ...zap.Field) {
+	accessLogger.Log(level, msg, fields...)
+}
+
+// Sync 刷新缓冲的日志，退出前调用
+func Sync() {
+	_ = logger.Sync()
+	if accessLogger != logger {
+		_ = accessLogger.Sync()
+	}
+}
+
 // With 返回带有指定字段的Logger
 func With(fields ...zap.Field) *zap.Logger {
 	return logger.With(fields...)
@@ -89,6 +186,16 @@ func With(fields ...zap.Field) *zap.Logger {
 
 // SetLevel 设置日志级别
 func SetLevel(level string) {
+	atomicLevel.SetLevel(parseLevel(level))
+}
+
+// Level 获取当前的日志级别
+func Level() string {
+	return atomicLevel.Level().String()
+}
+
+// parseLevel 解析日志级别，无法识别时使用 info
+func parseLevel(level string) zapcore.Level {
 	var zapLevel zapcore.Level
 	switch level {
 	case "debug":
@@ -102,5 +209,5 @@ func SetLevel(level string) {
 	default:
 		zapLevel = zap.InfoLevel
 	}
-	atomicLevel.SetLevel(zapLevel)
+	return zapLevel
 }
@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace 所有指标名称的前缀
+const namespace = "monica_proxy"
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Total number of HTTP requests by route, model, API key and status.",
+	}, []string{"route", "method", "model", "api_key", "status"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, model, API key and status.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"route", "method", "model", "api_key", "status"})
+
+	timeToFirstToken = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "stream_time_to_first_token_seconds",
+		Help:      "Time from the start of a streamed response to the first chunk sent to the client.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 4, 8, 16, 32},
+	}, []string{"model"})
+
+	streamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "stream_duration_seconds",
+		Help:      "Total duration of streamed responses.",
+		Buckets:   []float64{1, 2.5, 5, 10, 20, 40, 80, 160, 320},
+	}, []string{"model"})
+
+	activeStreams = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_streams",
+		Help:      "Number of streamed responses currently in progress.",
+	}, []string{"model"})
+
+	upstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "Monica upstream request errors by client and error class.",
+	}, []string{"client", "class"})
+
+	rateLimitRejections = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by the rate limiter.",
+	})
+
+	uploadCacheHits = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_cache_hits_total",
+		Help:      "Image upload cache hits.",
+	}, func() float64 {
+		hits, _ := loadUploadCacheStats()
+		return float64(hits)
+	})
+
+	uploadCacheMisses = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_cache_misses_total",
+		Help:      "Image upload cache misses.",
+	}, func() float64 {
+		_, misses := loadUploadCacheStats()
+		return float64(misses)
+	})
+)
+
+// otherModel 不在已知模型列表中的模型使用的标签
+const otherModel = "other"
+
+var (
+	// knownModels 允许作为指标标签的模型名，客户端可以发送任意模型名，其余的统一记为 other 以限制时间序列数量
+	knownModels atomic.Pointer[map[string]bool]
+	// uploadCacheStats 上传缓存统计的读取函数，指标在包初始化时注册，避免重复注册时 panic
+	uploadCacheStats atomic.Pointer[func() (hits, misses int64)]
+)
+
+// SetKnownModels 设置允许作为指标标签的模型名
+func SetKnownModels(models []string) {
+	known := make(map[string]bool, len(models))
+	for _, model := range models {
+		known[model] = true
+	}
+	knownModels.Store(&known)
+}
+
+// modelLabel 返回用于指标的模型标签，未设置模型时为空，未知模型记为 other
+func modelLabel(model string) string {
+	if model == "" {
+		return ""
+	}
+	if known := knownModels.Load(); known != nil && (*known)[model] {
+		return model
+	}
+	return otherModel
+}
+
+// Handler 返回 Prometheus 指标的 HTTP 处理器
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRequest 记录一次 HTTP 请求
+func ObserveRequest(route, method, model, apiKey string, status int, duration time.Duration) {
+	labels := prometheus.Labels{
+		"route":   route,
+		"method":  method,
+		"model":   modelLabel(model),
+		"api_key": apiKey,
+		"status":  strconv.Itoa(status),
+	}
+	requestsTotal.With(labels).Inc()
+	requestDuration.With(labels).Observe(duration.Seconds())
+}
+
+// StreamObserver 记录单个流式响应的指标
+type StreamObserver struct {
+	model      string
+	start      time.Time
+	firstToken bool
+}
+
+// StartStream 开始记录一个流式响应，结束时需要调用 Done
+func StartStream(model string) *StreamObserver {
+	model = modelLabel(model)
+	activeStreams.WithLabelValues(model).Inc()
+	return &StreamObserver{model: model, start: time.Now()}
+}
+
+// FirstToken 记录第一个数据块发送给客户端的时间，只有第一次调用生效
+func (o *StreamObserver) FirstToken() {
+	if o.firstToken {
+		return
+	}
+	o.firstToken = true
+	timeToFirstToken.WithLabelValues(o.model).Observe(time.Since(o.start).Seconds())
+}
+
+// Done 结束记录
+func (o *StreamObserver) Done() {
+	activeStreams.WithLabelValues(o.model).Dec()
+	streamDuration.WithLabelValues(o.model).Observe(time.Since(o.start).Seconds())
+}
+
+// UpstreamErrorHook 返回记录 Monica 请求错误的 resty 钩子，client 用于区分不同的客户端
+func UpstreamErrorHook(client string) resty.ErrorHook {
+	return func(_ *resty.Request, err error) {
+		upstreamErrors.WithLabelValues(client, errorClass(err)).Inc()
+	}
+}
+
+// errorClass 将上游错误归类：http_4xx/http_5xx、timeout、canceled、network
+func errorClass(err error) string {
+	var respErr *resty.ResponseError
+	if errors.As(err, &respErr) && respErr.Response != nil && respErr.Response.StatusCode() > 0 {
+		return "http_" + strconv.Itoa(respErr.Response.StatusCode()/100) + "xx"
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	default:
+		return "network"
+	}
+}
+
+// RateLimitRejected 记录一次被限流拒绝的请求
+func RateLimitRejected() {
+	rateLimitRejections.Inc()
+}
+
+// SetUploadCacheStats 设置上传缓存命中和未命中次数的读取函数，stats 在每次抓取时调用
+func SetUploadCacheStats(stats func() (hits, misses int64)) {
+	uploadCacheStats.Store(&stats)
+}
+
+// loadUploadCacheStats 读取上传缓存统计，未设置时返回0
+func loadUploadCacheStats() (int64, int64) {
+	stats := uploadCacheStats.Load()
+	if stats == nil {
+		return 0, 0
+	}
+	return (*stats)()
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestModelLabel(t *testing.T) {
+	SetKnownModels([]string{"gpt-4o", "dall-e-3"})
+
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"gpt-4o", "gpt-4o"},
+		{"dall-e-3", "dall-e-3"},
+		{"", ""},
+		{"random-model-123", otherModel},
+		{"GPT-4O", otherModel},
+	}
+	for _, tt := range tests {
+		if got := modelLabel(tt.model); got != tt.want {
+			t.Errorf("modelLabel(%q) = %q, want %q", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestObserveRequestUnknownModel(t *testing.T) {
+	SetKnownModels([]string{"gpt-4o"})
+
+	before := testutil.CollectAndCount(requestsTotal)
+	for _, model := range []string{"made-up-1", "made-up-2", "made-up-3"} {
+		ObserveRequest("/test/unknown", http.MethodPost, model, "none", http.StatusOK, time.Millisecond)
+	}
+
+	if got := testutil.ToFloat64(requestsTotal.WithLabelValues("/test/unknown", http.MethodPost, otherModel, "none", "200")); got != 3 {
+		t.Errorf("requests with model=other = %v, want 3", got)
+	}
+	if got := testutil.CollectAndCount(requestsTotal); got != before+1 {
+		t.Errorf("series count = %d, want %d", got, before+1)
+	}
+}
+
+func TestSetUploadCacheStatsTwice(t *testing.T) {
+	SetUploadCacheStats(func() (int64, int64) { return 1, 2 })
+	SetUploadCacheStats(func() (int64, int64) { return 5, 7 })
+
+	if got := testutil.ToFloat64(uploadCacheHits); got != 5 {
+		t.Errorf("upload cache hits = %v, want 5", got)
+	}
+	if got := testutil.ToFloat64(uploadCacheMisses); got != 7 {
+		t.Errorf("upload cache misses = %v, want 7", got)
+	}
+}
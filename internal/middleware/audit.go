@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"monica-proxy/internal/audit"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/logger"
+	"monica-proxy/internal/redact"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Audit 创建审计日志中间件，只记录 POST 请求，请求内容由处理器和服务层通过 context 补充
+func Audit(cfg *config.Config, auditLogger *audit.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if auditLogger == nil || req.Method != http.MethodPost {
+				return next(c)
+			}
+
+			entry := auditLogger.Start(strings.TrimPrefix(req.Header.Get(echo.HeaderAuthorization), "Bearer "))
+			if entry == nil {
+				return next(c)
+			}
+			c.SetRequest(req.WithContext(audit.WithEntry(req.Context(), entry)))
+
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil {
+				status = errorStatus(err)
+			}
+			requestID := req.Header.Get(echo.HeaderXRequestID)
+			if requestID == "" {
+				requestID = c.Response().Header().Get(echo.HeaderXRequestID)
+			}
+			model, _ := c.Get(contextKeyModel).(string)
+			info := audit.RequestInfo{
+				RequestID: requestID,
+				APIKey:    apiKeyLabel(cfg, req),
+				Method:    req.Method,
+				Route:     c.Path(),
+				Model:     model,
+				Status:    status,
+			}
+			if werr := entry.Finish(info, err); werr != nil {
+				logger.Warn("写入审计日志失败", redact.Error(werr))
+			}
+			return err
+		}
+	}
+}
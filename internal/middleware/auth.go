@@ -3,6 +3,7 @@ package middleware
 import (
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/logger"
+	"monica-proxy/internal/redact"
 	"net/http"
 	"strings"
 
@@ -10,29 +11,51 @@ import (
 	"go.uber.org/zap"
 )
 
+// 健康检查和版本信息的路径
+const (
+	HealthzPath = "/healthz"
+	ReadyzPath  = "/readyz"
+	VersionPath = "/version"
+)
+
+// AdminPathPrefix 管理接口的路径前缀，使用单独的管理 Token 认证
+const AdminPathPrefix = "/admin"
+
+// publicPaths 无需认证的路径，探针通常无法携带 Token
+var publicPaths = map[string]bool{
+	HealthzPath: true,
+	ReadyzPath:  true,
+	VersionPath: true,
+}
+
+// publicPathPrefixes 无需认证的路径前缀
+var publicPathPrefixes = []string{
+	"/v1/images/content/", // 图片地址需要能直接在浏览器中打开，ID本身不可猜测
+}
+
 // BearerAuth 创建一个Bearer Token认证中间件
 func BearerAuth(cfg *config.Config) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			if isPublicPath(c.Request().URL.Path) || isPublicMetricsPath(cfg, c.Request().URL.Path) {
+				return next(c)
+			}
+			// 管理接口由 AdminAuth 认证
+			if cfg.Admin.Enabled && isAdminPath(c.Request().URL.Path) {
+				return next(c)
+			}
+
 			// 获取Authorization header
 			auth := c.Request().Header.Get("Authorization")
 
 			// 检查header格式
 			if auth == "" || !strings.HasPrefix(auth, "Bearer ") {
-				if cfg.Logging.MaskSensitive {
-					logger.Warn("无效的授权头",
-						zap.String("method", c.Request().Method),
-						zap.String("uri", c.Request().RequestURI),
-						zap.String("remote_addr", c.RealIP()),
-					)
-				} else {
-					logger.Warn("无效的授权头",
-						zap.String("method", c.Request().Method),
-						zap.String("uri", c.Request().RequestURI),
-						zap.String("remote_addr", c.RealIP()),
-						zap.String("auth_header", auth),
-					)
-				}
+				logger.Warn("无效的授权头",
+					zap.String("method", c.Request().Method),
+					zap.String("uri", redact.URL(c.Request().RequestURI)),
+					zap.String("remote_addr", c.RealIP()),
+					zap.String("auth_header", redact.Header(echo.HeaderAuthorization, auth)),
+				)
 				return echo.NewHTTPError(http.StatusUnauthorized, "invalid authorization header")
 			}
 
@@ -41,20 +64,12 @@ func BearerAuth(cfg *config.Config) echo.MiddlewareFunc {
 
 			// 验证token
 			if token != cfg.Security.BearerToken || token == "" {
-				if cfg.Logging.MaskSensitive {
-					logger.Warn("无效的Token",
-						zap.String("method", c.Request().Method),
-						zap.String("uri", c.Request().RequestURI),
-						zap.String("remote_addr", c.RealIP()),
-					)
-				} else {
-					logger.Warn("无效的Token",
-						zap.String("method", c.Request().Method),
-						zap.String("uri", c.Request().RequestURI),
-						zap.String("remote_addr", c.RealIP()),
-						zap.String("token", token),
-					)
-				}
+				logger.Warn("无效的Token",
+					zap.String("method", c.Request().Method),
+					zap.String("uri", redact.URL(c.Request().RequestURI)),
+					zap.String("remote_addr", c.RealIP()),
+					zap.String("token", redact.Secret(token)),
+				)
 				return echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
 			}
 
@@ -62,3 +77,46 @@ func BearerAuth(cfg *config.Config) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// AdminAuth 创建管理接口的认证中间件，只接受配置的管理 Token
+func AdminAuth(cfg *config.Config) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			auth := c.Request().Header.Get("Authorization")
+			token, ok := strings.CutPrefix(auth, "Bearer ")
+			if !ok || token == "" || token != cfg.Admin.Token {
+				logger.Warn("无效的管理Token",
+					zap.String("method", c.Request().Method),
+					zap.String("uri", redact.URL(c.Request().RequestURI)),
+					zap.String("remote_addr", c.RealIP()),
+					zap.String("auth_header", redact.Header(echo.HeaderAuthorization, auth)),
+				)
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid admin token")
+			}
+			return next(c)
+		}
+	}
+}
+
+// isAdminPath 判断请求路径是否属于管理接口
+func isAdminPath(path string) bool {
+	return path == AdminPathPrefix || strings.HasPrefix(path, AdminPathPrefix+"/")
+}
+
+// isPublicPath 判断请求路径是否无需认证
+func isPublicPath(path string) bool {
+	if publicPaths[path] {
+		return true
+	}
+	for _, prefix := range publicPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPublicMetricsPath 配置为无需认证时，Prometheus 可以直接抓取指标
+func isPublicMetricsPath(cfg *config.Config, path string) bool {
+	return cfg.Metrics.Enabled && !cfg.Metrics.RequireAuth && path == cfg.Metrics.Path
+}
@@ -2,7 +2,9 @@ package middleware
 
 import (
 	"monica-proxy/internal/errors"
+	"monica-proxy/internal/inflight"
 	"monica-proxy/internal/logger"
+	"monica-proxy/internal/redact"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
@@ -26,17 +28,25 @@ func ErrorHandler() echo.HTTPErrorHandler {
 		// 获取请求ID
 		requestID := c.Request().Header.Get(echo.HeaderXRequestID)
 
+		// 请求被主动取消导致的错误统一返回取消错误
+		if inflight.Cancelled(c.Request().Context()) {
+			err = errors.NewRequestCancelledError(err)
+		}
+
 		// 处理应用错误
 		if appErr, ok := err.(*errors.AppError); ok {
 			status, _ := appErr.HTTPResponse()
-			response := buildErrorResponse(appErr.Code, appErr.Message, requestID)
+			response := buildErrorResponse(appErr.ResponseCode(), appErr.Message, requestID)
+			if appErr.Param != "" {
+				response["error"].(map[string]any)["param"] = appErr.Param
+			}
 
 			// 记录错误日志
 			logger.Error("应用错误",
 				zap.Int("status", status),
 				zap.Int("error_code", int(appErr.Code)),
 				zap.String("error_msg", appErr.Message),
-				zap.Error(appErr.Err),
+				redact.Error(appErr.Err),
 				zap.String("request_id", requestID),
 			)
 
@@ -59,7 +69,7 @@ func ErrorHandler() echo.HTTPErrorHandler {
 			logger.Error("框架错误",
 				zap.Int("status", status),
 				zap.String("error_msg", message),
-				zap.Error(err),
+				redact.Error(err),
 				zap.String("request_id", requestID),
 			)
 
@@ -74,7 +84,7 @@ func ErrorHandler() echo.HTTPErrorHandler {
 		// 记录错误日志
 		logger.Error("未分类错误",
 			zap.Int("status", status),
-			zap.Error(err),
+			redact.Error(err),
 			zap.String("request_id", requestID),
 		)
 
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/inflight"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// InFlight 创建登记正在处理的请求的中间件，只跟踪 POST 请求，管理接口自身不跟踪
+// 请求以 X-Request-Id 登记，可以通过管理接口查看和取消
+// 客户端指定的 ID 与正在处理的请求重复时改用服务端生成的 ID，并写回请求和响应头，日志和审计使用同一个 ID
+func InFlight(cfg *config.Config, registry *inflight.Registry) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Method != http.MethodPost || isAdminPath(req.URL.Path) {
+				return next(c)
+			}
+
+			requestID := c.Response().Header().Get(echo.HeaderXRequestID)
+			if requestID == "" {
+				requestID = req.Header.Get(echo.HeaderXRequestID)
+			}
+			if requestID == "" {
+				return next(c)
+			}
+
+			start := func(id string) (context.Context, func(), error) {
+				return registry.Start(req.Context(), &inflight.Request{
+					ID:     id,
+					Method: req.Method,
+					Path:   req.URL.Path,
+					APIKey: apiKeyLabel(cfg, req),
+				})
+			}
+			ctx, done, err := start(requestID)
+			if err != nil {
+				requestID = uuid.New().String()
+				req.Header.Set(echo.HeaderXRequestID, requestID)
+				c.Response().Header().Set(echo.HeaderXRequestID, requestID)
+				if ctx, done, err = start(requestID); err != nil {
+					return next(c)
+				}
+			}
+			defer done()
+			c.SetRequest(req.WithContext(ctx))
+			return next(c)
+		}
+	}
+}
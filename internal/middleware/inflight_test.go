@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/inflight"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestInFlightDuplicateRequestID(t *testing.T) {
+	registry := inflight.NewRegistry()
+	_, done, err := registry.Start(t.Context(), &inflight.Request{ID: "client-id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer done()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set(echo.HeaderXRequestID, "client-id")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	var tracked *inflight.Request
+	handler := InFlight(&config.Config{}, registry)(func(c echo.Context) error {
+		tracked = inflight.FromContext(c.Request().Context())
+		return nil
+	})
+	if err := handler(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if tracked == nil {
+		t.Fatal("request with duplicate id not tracked")
+	}
+	if tracked.ID == "client-id" {
+		t.Fatal("duplicate request reused client id")
+	}
+	if got := c.Request().Header.Get(echo.HeaderXRequestID); got != tracked.ID {
+		t.Errorf("request header id = %q, want %q", got, tracked.ID)
+	}
+	if got := rec.Header().Get(echo.HeaderXRequestID); got != tracked.ID {
+		t.Errorf("response header id = %q, want %q", got, tracked.ID)
+	}
+	if got := registry.List(); len(got) != 1 || got[0].ID != "client-id" {
+		t.Errorf("List() = %+v, want only the original request", got)
+	}
+}
@@ -3,10 +3,12 @@ package middleware
 import (
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/logger"
+	"monica-proxy/internal/redact"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 // RequestLogger 创建一个请求日志记录中间件
@@ -37,7 +39,7 @@ func RequestLogger(cfg *config.Config) echo.MiddlewareFunc {
 			// 构建日志字段
 			fields := []zap.Field{
 				zap.String("method", req.Method),
-				zap.String("uri", req.RequestURI),
+				zap.String("uri", redact.URL(req.RequestURI)),
 				zap.Int("status", res.Status),
 				zap.Duration("latency", duration),
 				zap.String("remote_addr", c.RealIP()),
@@ -50,19 +52,19 @@ func RequestLogger(cfg *config.Config) echo.MiddlewareFunc {
 				fields = append(fields, zap.Int64("response_size", res.Size))
 			}
 
-			// 根据错误情况记录不同级别的日志
+			// 根据错误情况记录不同级别的日志，写入请求日志的 sink
 			if err != nil {
-				fields = append(fields, zap.Error(err))
-				logger.Error("请求失败", fields...)
+				fields = append(fields, redact.Error(err))
+				logger.Access(zapcore.ErrorLevel, "请求失败", fields...)
 			} else {
 				// 根据状态码决定日志级别
 				switch {
 				case res.Status >= 500:
-					logger.Error("请求完成但服务器错误", fields...)
+					logger.Access(zapcore.ErrorLevel, "请求完成但服务器错误", fields...)
 				case res.Status >= 400:
-					logger.Warn("请求完成但客户端错误", fields...)
+					logger.Access(zapcore.WarnLevel, "请求完成但客户端错误", fields...)
 				default:
-					logger.Info("请求完成", fields...)
+					logger.Access(zapcore.InfoLevel, "请求完成", fields...)
 				}
 			}
 
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/inflight"
+	"monica-proxy/internal/metrics"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// contextKeyModel 处理器在 echo.Context 中保存请求模型的键
+const contextKeyModel = "model"
+
+// SetRequestModel 记录请求使用的模型，用于按模型统计指标和管理接口展示
+func SetRequestModel(c echo.Context, model string) {
+	c.Set(contextKeyModel, model)
+	inflight.FromContext(c.Request().Context()).SetModel(model)
+}
+
+// Metrics 创建记录请求数和耗时的中间件
+func Metrics(cfg *config.Config) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !cfg.Metrics.Enabled || c.Request().URL.Path == cfg.Metrics.Path {
+				return next(c)
+			}
+
+			start := time.Now()
+			err := next(c)
+
+			// 出错时响应由错误处理器在中间件之后写入，需要从错误中获取状态码
+			status := c.Response().Status
+			if err != nil {
+				status = errorStatus(err)
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			model, _ := c.Get(contextKeyModel).(string)
+			metrics.ObserveRequest(route, c.Request().Method, model, apiKeyLabel(cfg, c.Request()), status, time.Since(start))
+			return err
+		}
+	}
+}
+
+// errorStatus 获取错误对应的HTTP状态码
+func errorStatus(err error) int {
+	switch e := err.(type) {
+	case *errors.AppError:
+		return e.Status
+	case *echo.HTTPError:
+		return e.Code
+	}
+	return http.StatusInternalServerError
+}
+
+// apiKeyLabel 返回用于指标的 API Key 标签，只保留末尾4位，无效的 Key 统一归为 invalid 以限制标签数量
+func apiKeyLabel(cfg *config.Config, req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	if auth == "" {
+		return "none"
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	if token != cfg.Security.BearerToken {
+		return "invalid"
+	}
+	if len(token) <= 8 {
+		return "****"
+	}
+	return "..." + token[len(token)-4:]
+}
@@ -3,8 +3,10 @@ package middleware
 import (
 	"context"
 	"monica-proxy/internal/config"
+	"monica-proxy/internal/metrics"
 	"net"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
@@ -18,6 +20,13 @@ type clientEntry struct {
 	lastSeen time.Time
 }
 
+// RateLimitClient 客户端限流状态，用于管理接口展示
+type RateLimitClient struct {
+	IP       string    `json:"ip"`
+	Tokens   float64   `json:"tokens"` // 当前可用的令牌数，小于1时请求会被拒绝
+	LastSeen time.Time `json:"last_seen"`
+}
+
 // RateLimiter 限流器结构
 type RateLimiter struct {
 	mu      sync.RWMutex
@@ -107,6 +116,26 @@ func (rl *RateLimiter) cleanupInactiveClients() {
 	}
 }
 
+// Clients 获取所有客户端的限流状态，按最后访问时间倒序
+func (rl *RateLimiter) Clients() []RateLimitClient {
+	now := time.Now()
+	rl.mu.RLock()
+	clients := make([]RateLimitClient, 0, len(rl.clients))
+	for ip, entry := range rl.clients {
+		clients = append(clients, RateLimitClient{
+			IP:       ip,
+			Tokens:   entry.limiter.TokensAt(now),
+			LastSeen: entry.lastSeen,
+		})
+	}
+	rl.mu.RUnlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].LastSeen.After(clients[j].LastSeen)
+	})
+	return clients
+}
+
 // Close 关闭限流器，停止清理协程
 func (rl *RateLimiter) Close() {
 	rl.cancel()
@@ -152,6 +181,14 @@ func getFirstIP(ips string) string {
 var globalRateLimiter *RateLimiter
 var rateLimiterOnce sync.Once
 
+// RateLimitClients 获取全局限流器的客户端状态，未启用限流时返回 nil
+func RateLimitClients() []RateLimitClient {
+	if globalRateLimiter == nil {
+		return nil
+	}
+	return globalRateLimiter.Clients()
+}
+
 // RateLimit 创建限流中间件
 func RateLimit(cfg *config.Config) echo.MiddlewareFunc {
 	// 如果禁用限流，返回空中间件
@@ -168,6 +205,11 @@ func RateLimit(cfg *config.Config) echo.MiddlewareFunc {
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			// 健康检查不限流，避免探针失败导致实例被重启
+			if publicPaths[c.Request().URL.Path] {
+				return next(c)
+			}
+
 			// 安全地获取客户端IP
 			clientIP := getClientIP(c)
 
@@ -176,6 +218,7 @@ func RateLimit(cfg *config.Config) echo.MiddlewareFunc {
 
 			// 检查是否允许请求
 			if !limiter.Allow() {
+				metrics.RateLimitRejected()
 				return echo.NewHTTPError(http.StatusTooManyRequests, map[string]any{
 					"error": map[string]any{
 						"code":        "rate_limit_exceeded",
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"fmt"
+	"monica-proxy/internal/tracing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Tracing 创建请求追踪中间件，从请求头中读取 W3C trace context，为每个请求创建根 span
+func Tracing() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+			route := c.Path()
+			if route == "" {
+				route = req.URL.Path
+			}
+			ctx, span := tracing.StartServer(ctx, fmt.Sprintf("%s %s", req.Method, route),
+				attribute.String("http.request.method", req.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", req.URL.Path),
+				attribute.String("client.address", c.RealIP()),
+			)
+			defer span.End()
+
+			// 使用 Echo 的 RequestID 中间件生成的请求ID
+			requestID := req.Header.Get(echo.HeaderXRequestID)
+			if requestID == "" {
+				requestID = c.Response().Header().Get(echo.HeaderXRequestID)
+			}
+			span.SetAttributes(attribute.String("http.request_id", requestID))
+
+			c.SetRequest(req.WithContext(ctx))
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil {
+				status = errorStatus(err)
+				span.RecordError(err)
+			}
+			if model, ok := c.Get(contextKeyModel).(string); ok && model != "" {
+				span.SetAttributes(attribute.String("gen_ai.request.model", model))
+			}
+			span.SetAttributes(attribute.Int("http.response.status_code", status))
+			if status >= 500 {
+				span.SetStatus(codes.Error, fmt.Sprintf("status %d", status))
+			}
+			return err
+		}
+	}
+}
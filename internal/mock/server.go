@@ -0,0 +1,466 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math/rand/v2"
+	"monica-proxy/internal/types"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// directivePattern 提示词中控制 mock 行为的指令，如 [mock:think]、[mock:fail=500]、[mock:delay=200ms]
+var directivePattern = regexp.MustCompile(`\[mock:([a-z]+)(?:=([^\]]*))?\]`)
+
+// Options mock 服务的延迟和故障注入配置
+type Options struct {
+	// Cookie 不为空时要求请求携带相同的 cookie，否则返回 401
+	Cookie string
+	// Latency 每个 API 请求返回前的延迟
+	Latency time.Duration
+	// ChunkDelay SSE 数据块之间的间隔
+	ChunkDelay time.Duration
+	// FailRate 随机返回 FailStatus 的请求比例 (0-1)
+	FailRate   float64
+	FailStatus int
+	// IndexDelay 上传的文件在多长时间后解析完成
+	IndexDelay time.Duration
+	// ImageDelay 图片任务在多长时间后生成完成
+	ImageDelay time.Duration
+}
+
+// Server 模拟 Monica API 的本地服务，用于没有 Cookie 时的离线开发和测试
+// 对话回复、上传的文件和生成的图片都只保存在内存中
+type Server struct {
+	baseURL string
+	opts    Options
+
+	mu      sync.Mutex
+	nextID  int
+	objects map[string][]byte
+	files   map[string]*mockFile
+	images  map[int]*mockImage
+}
+
+// mockFile 通过 batch_create_llm_file 创建的文件
+type mockFile struct {
+	info      types.FileInfo
+	createdAt time.Time
+}
+
+// mockImage 提交的图片任务
+type mockImage struct {
+	urls      []string
+	createdAt time.Time
+	failMsg   string
+}
+
+// directives 从提示词中解析出的指令
+type directives struct {
+	think      bool
+	cut        bool
+	failStatus int
+	delay      time.Duration
+	reply      string
+}
+
+// NewServer 创建 mock 服务，baseURL 为客户端访问该服务的地址，用于生成上传和 CDN 地址
+func NewServer(baseURL string, opts Options) *Server {
+	if opts.FailStatus == 0 {
+		opts.FailStatus = http.StatusInternalServerError
+	}
+	return &Server{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		opts:    opts,
+		objects: make(map[string][]byte),
+		files:   make(map[string]*mockFile),
+		images:  make(map[int]*mockImage),
+	}
+}
+
+// Handler 返回 mock 服务的路由
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("POST "+types.BotChatPath, s.api(s.handleChat))
+	mux.Handle("POST "+types.CustomBotChatPath, s.api(s.handleChat))
+	mux.Handle("POST "+types.PreSignPath, s.api(s.handlePreSign))
+	mux.Handle("POST "+types.FileUploadPath, s.api(s.handleCreateFile))
+	mux.Handle("POST "+types.FileGetPath, s.api(s.handleGetFile))
+	mux.Handle("POST "+types.ImageGeneratePath, s.api(s.handleImageTask))
+	mux.Handle("POST "+types.ImageResultPath, s.api(s.handleImageResult))
+	mux.HandleFunc("PUT /upload/{id}", s.handleUpload)
+	mux.HandleFunc("GET /cdn/{id}", s.handleCDN)
+	return mux
+}
+
+// api 为 API 请求添加 Cookie 校验、延迟和随机故障
+func (s *Server) api(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.opts.Cookie != "" && r.Header.Get("Cookie") != s.opts.Cookie {
+			writeError(w, http.StatusUnauthorized, "invalid cookie")
+			return
+		}
+		if !sleep(r, s.opts.Latency) {
+			return
+		}
+		if s.opts.FailRate > 0 && rand.Float64() < s.opts.FailRate {
+			writeError(w, s.opts.FailStatus, "mock failure injected")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// handleChat 以 SSE 返回回复，支持 thinking 状态、中途断开和指定状态码的失败
+func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		BotUID string `json:"bot_uid"`
+		Data   struct {
+			Items []types.Item `json:"items"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var prompt string
+	if items := req.Data.Items; len(items) > 0 {
+		prompt = items[len(items)-1].Data.Content
+	}
+	d := parseDirectives(prompt)
+	if d.failStatus != 0 {
+		writeError(w, d.failStatus, "mock failure requested by prompt")
+		return
+	}
+	delay := s.opts.ChunkDelay
+	if d.delay > 0 {
+		delay = d.delay
+	}
+	reply := d.reply
+	if reply == "" {
+		reply = fmt.Sprintf("This is a mock reply from %s. You said: %s", req.BotUID, strings.TrimSpace(directivePattern.ReplaceAllString(prompt, "")))
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	send := func(data any) bool {
+		line, _ := json.Marshal(data)
+		fmt.Fprintf(w, "data: %s\n\n", line)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return sleep(r, delay)
+	}
+
+	if d.think {
+		if !send(map[string]any{"agent_status": map[string]any{"type": "thinking", "text": "Thinking"}}) {
+			return
+		}
+		for _, chunk := range splitWords("Let me think about this request step by step.") {
+			status := map[string]any{"type": "thinking_detail_stream", "metadata": map[string]string{"reasoning_detail": chunk}}
+			if !send(map[string]any{"agent_status": status}) {
+				return
+			}
+		}
+	}
+	chunks := splitWords(reply)
+	if d.cut {
+		chunks = chunks[:len(chunks)/2]
+	}
+	for _, chunk := range chunks {
+		if !send(map[string]any{"text": chunk}) {
+			return
+		}
+	}
+	if !d.cut {
+		send(map[string]any{"text": "", "finished": true})
+	}
+}
+
+// handlePreSign 返回指向 mock 服务的上传地址和 CDN 地址
+func (s *Server) handlePreSign(w http.ResponseWriter, r *http.Request) {
+	var req types.PreSignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var resp types.PreSignResponse
+	for range req.FilenameList {
+		id := s.newID("obj")
+		resp.Data.PreSignURLList = append(resp.Data.PreSignURLList, s.baseURL+"/upload/"+id+"?X-Amz-Signature=mock")
+		resp.Data.ObjectURLList = append(resp.Data.ObjectURLList, "mock://objects/"+id)
+		resp.Data.CDNURLList = append(resp.Data.CDNURLList, s.baseURL+"/cdn/"+id)
+	}
+	writeJSON(w, resp)
+}
+
+// handleUpload 保存通过预签名地址上传的数据
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.mu.Lock()
+	s.objects[r.PathValue("id")] = data
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleCDN 返回上传的数据或生成的图片
+func (s *Server) handleCDN(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	data, ok := s.objects[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Write(data)
+}
+
+// handleCreateFile 创建文件对象，文件在 IndexDelay 之后解析完成
+func (s *Server) handleCreateFile(w http.ResponseWriter, r *http.Request) {
+	var req types.FileUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var resp types.FileUploadResponse
+	for _, info := range req.Data {
+		info.FileUID = s.newID("file")
+		info.FileTokens = max(info.FileSize/4, 1)
+		info.FileChunks = info.FileSize/4096 + 1
+		s.mu.Lock()
+		s.files[info.FileUID] = &mockFile{info: info, createdAt: time.Now()}
+		s.mu.Unlock()
+
+		resp.Data.Items = append(resp.Data.Items, struct {
+			FileName   string `json:"file_name"`
+			FileType   string `json:"file_type"`
+			FileSize   int64  `json:"file_size"`
+			FileUID    string `json:"file_uid"`
+			FileTokens int64  `json:"file_tokens"`
+			FileChunks int64  `json:"file_chunks"`
+		}{info.FileName, info.FileType, info.FileSize, info.FileUID, 0, 0})
+	}
+	writeJSON(w, resp)
+}
+
+// handleGetFile 返回文件的解析进度，未知的文件不返回
+func (s *Server) handleGetFile(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		FileUIDs []string `json:"file_uids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items := make([]map[string]any, 0, len(req.FileUIDs))
+	s.mu.Lock()
+	for _, uid := range req.FileUIDs {
+		file, ok := s.files[uid]
+		if !ok {
+			continue
+		}
+		item := map[string]any{
+			"file_uid":       uid,
+			"file_name":      file.info.FileName,
+			"file_type":      file.info.FileType,
+			"file_size":      file.info.FileSize,
+			"url":            file.info.FileURL,
+			"index_state":    1,
+			"index_progress": 50,
+		}
+		if time.Since(file.createdAt) >= s.opts.IndexDelay {
+			item["index_state"] = 2
+			item["index_progress"] = 100
+			item["file_tokens"] = file.info.FileTokens
+			item["file_chunks"] = file.info.FileChunks
+		}
+		items = append(items, item)
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]any{"code": 0, "msg": "success", "data": map[string]any{"items": items}})
+}
+
+// handleImageTask 提交图片任务，生成纯色的占位图片，宽高比与请求一致
+func (s *Server) handleImageTask(w http.ResponseWriter, r *http.Request) {
+	var req types.MonicaImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	d := parseDirectives(req.Prompt)
+	if d.failStatus != 0 {
+		writeError(w, d.failStatus, "mock failure requested by prompt")
+		return
+	}
+
+	task := &mockImage{createdAt: time.Now()}
+	if d.cut {
+		task.failMsg = "mock image generation failed"
+	}
+	for i := 0; i < max(req.ImageCount, 1); i++ {
+		id := s.newID("img") + ".png"
+		data, err := placeholderImage(req.AspectRatio, req.Prompt)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.mu.Lock()
+		s.objects[id] = data
+		s.mu.Unlock()
+		task.urls = append(task.urls, s.baseURL+"/cdn/"+id)
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	taskID := s.nextID
+	s.images[taskID] = task
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]any{"code": 0, "msg": "success", "data": map[string]any{
+		"image_tools_id": taskID,
+		"expected_time":  max(int(s.opts.ImageDelay/time.Second), 1),
+	}})
+}
+
+// handleImageResult 在 ImageDelay 之前返回空结果，之后返回图片地址
+func (s *Server) handleImageResult(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ImageToolsID int `json:"image_tools_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.mu.Lock()
+	task, ok := s.images[req.ImageToolsID]
+	s.mu.Unlock()
+	switch {
+	case !ok:
+		writeJSON(w, map[string]any{"code": 404, "msg": "image task not found"})
+		return
+	case task.failMsg != "":
+		writeJSON(w, map[string]any{"code": 500, "msg": task.failMsg})
+		return
+	}
+
+	urls := []string{}
+	if time.Since(task.createdAt) >= s.opts.ImageDelay {
+		urls = task.urls
+	}
+	writeJSON(w, map[string]any{"code": 0, "msg": "success", "data": map[string]any{
+		"record": map[string]any{"result": map[string]any{"cdn_url_list": urls}},
+	}})
+}
+
+// newID 生成递增的ID
+func (s *Server) newID(prefix string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	return fmt.Sprintf("mock-%s-%d", prefix, s.nextID)
+}
+
+// parseDirectives 解析提示词中的 [mock:...] 指令
+func parseDirectives(prompt string) directives {
+	var d directives
+	for _, match := range directivePattern.FindAllStringSubmatch(prompt, -1) {
+		switch match[1] {
+		case "think":
+			d.think = true
+		case "cut":
+			d.cut = true
+		case "fail":
+			d.failStatus = http.StatusInternalServerError
+			if status, err := strconv.Atoi(match[2]); err == nil {
+				d.failStatus = status
+			}
+		case "delay":
+			d.delay, _ = time.ParseDuration(match[2])
+		case "reply":
+			d.reply = match[2]
+		}
+	}
+	return d
+}
+
+// splitWords 按单词拆分回复，保留空格，模拟逐段输出
+func splitWords(s string) []string {
+	var chunks []string
+	for _, word := range strings.SplitAfter(s, " ") {
+		if word != "" {
+			chunks = append(chunks, word)
+		}
+	}
+	return chunks
+}
+
+// placeholderImage 生成按宽高比缩放的纯色 PNG，颜色由提示词决定
+func placeholderImage(aspectRatio, prompt string) ([]byte, error) {
+	width, height := 512, 512
+	if w, h, ok := strings.Cut(aspectRatio, ":"); ok {
+		wf, err1 := strconv.ParseFloat(w, 64)
+		hf, err2 := strconv.ParseFloat(h, 64)
+		if err1 == nil && err2 == nil && wf > 0 && hf > 0 {
+			height = int(float64(width) * hf / wf)
+		}
+	}
+
+	var hash uint32
+	for _, c := range prompt {
+		hash = hash*31 + uint32(c)
+	}
+	fill := color.RGBA{R: uint8(hash), G: uint8(hash >> 8), B: uint8(hash >> 16), A: 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = fill.R, fill.G, fill.B, fill.A
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sleep 等待指定时间，请求被取消时返回 false
+func sleep(r *http.Request, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	select {
+	case <-time.After(d):
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// writeJSON 返回 JSON 响应
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError 返回与 Monica 相同格式的错误响应
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"code": status, "msg": msg})
+}
@@ -0,0 +1,27 @@
+package monica
+
+import (
+	"monica-proxy/internal/errors"
+	"sync/atomic"
+)
+
+// accountDisabled 管理接口禁用账号后，新的聊天、图片和上传请求不再发往 Monica
+var accountDisabled atomic.Bool
+
+// SetAccountDisabled 禁用或启用 Monica 账号，重启后恢复为启用
+func SetAccountDisabled(disabled bool) {
+	accountDisabled.Store(disabled)
+}
+
+// AccountDisabled 账号是否已被禁用
+func AccountDisabled() bool {
+	return accountDisabled.Load()
+}
+
+// CheckAccount 账号被禁用时返回服务繁忙错误，已经在处理的请求不受影响
+func CheckAccount() error {
+	if accountDisabled.Load() {
+		return errors.NewServiceBusyError("Monica 账号已被管理员禁用")
+	}
+	return nil
+}
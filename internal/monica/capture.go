@@ -0,0 +1,72 @@
+package monica
+
+import (
+	"fmt"
+	"io"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/logger"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"go.uber.org/zap"
+)
+
+// captureReader 将读取到的原始 SSE 数据同时写入捕获文件
+// 只记录实际被读取的部分，达到输出限制提前结束时文件同样在该处结束
+type captureReader struct {
+	io.ReadCloser
+	file *os.File
+	err  error
+}
+
+// Read 读取响应体并写入捕获文件，写入失败后不再写入，不影响响应的处理
+func (r *captureReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 && r.err == nil {
+		if _, r.err = r.file.Write(p[:n]); r.err != nil {
+			logger.Warn("写入SSE捕获文件失败", zap.String("path", r.file.Name()), zap.Error(r.err))
+		}
+	}
+	return n, err
+}
+
+// Close 关闭响应体和捕获文件
+func (r *captureReader) Close() error {
+	_ = r.file.Close()
+	return r.ReadCloser.Close()
+}
+
+// captureResponse 启用 SSE 捕获时替换响应体，使之后读取的原始数据同时写入 CaptureDir
+// 文件名包含时间、请求类型和 task_uid，可以用 replay 命令离线重放
+func captureResponse(cfg *config.Config, kind, taskUID string, resp *resty.Response) {
+	if !cfg.Debug.CaptureSSE || resp == nil || resp.RawResponse == nil {
+		return
+	}
+	if err := os.MkdirAll(cfg.Debug.CaptureDir, 0o755); err != nil {
+		logger.Warn("创建SSE捕获目录失败", zap.String("dir", cfg.Debug.CaptureDir), zap.Error(err))
+		return
+	}
+
+	file, err := os.Create(filepath.Join(cfg.Debug.CaptureDir, captureFileName(time.Now(), kind, taskUID)))
+	if err != nil {
+		logger.Warn("创建SSE捕获文件失败", zap.String("dir", cfg.Debug.CaptureDir), zap.Error(err))
+		return
+	}
+	resp.RawResponse.Body = &captureReader{ReadCloser: resp.RawResponse.Body, file: file}
+	logger.Debug("SSE捕获已启用", zap.String("path", file.Name()))
+}
+
+// captureFileName 生成捕获文件名，task_uid 中的冒号等字符在部分文件系统中不可用，替换为下划线
+func captureFileName(now time.Time, kind, taskUID string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, taskUID)
+	return fmt.Sprintf("%s-%s-%s.sse", now.Format("20060102T150405.000"), kind, safe)
+}
@@ -0,0 +1,85 @@
+package monica
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+func TestCaptureFileName(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 30, 45, 123e6, time.UTC)
+	got := captureFileName(now, "chat", "task:1b2c/../x y")
+	if want := "20250601T123045.123-chat-task_1b2c_.._x_y.sse"; got != want {
+		t.Errorf("captureFileName() = %q, want %q", got, want)
+	}
+}
+
+// TestReplayGolden 将 testdata 中捕获的 SSE 分别按流式和非流式转换，与 golden 文件比较
+// 转换逻辑变化时使用 go test -update 重新生成
+func TestReplayGolden(t *testing.T) {
+	captures, err := filepath.Glob(filepath.Join("testdata", "*.sse"))
+	if err != nil || len(captures) == 0 {
+		t.Fatalf("no captures in testdata: %v", err)
+	}
+	ctx := WithResponseMeta(context.Background(), ResponseMeta{ID: "chatcmpl-replay", Fingerprint: "replay"})
+
+	for _, capture := range captures {
+		data, err := os.ReadFile(capture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		base := strings.TrimSuffix(capture, ".sse")
+
+		for _, limits := range []struct {
+			name   string
+			limits OutputLimits
+		}{
+			{"", OutputLimits{}},
+			{".stop", OutputLimits{Stop: []string{"END"}}},
+		} {
+			t.Run(filepath.Base(base)+limits.name, func(t *testing.T) {
+				var stream bytes.Buffer
+				if err := StreamMonicaSSEToClient(ctx, "gpt-4o", &stream, limits.limits, bytes.NewReader(data)); err != nil {
+					t.Fatalf("StreamMonicaSSEToClient() error = %v", err)
+				}
+				checkGolden(t, base+limits.name+".stream.golden", stream.Bytes())
+
+				completion, err := CollectMonicaSSEToCompletion(ctx, "gpt-4o", limits.limits, bytes.NewReader(data))
+				if err != nil {
+					t.Fatalf("CollectMonicaSSEToCompletion() error = %v", err)
+				}
+				out, err := json.MarshalIndent(completion, "", "  ")
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkGolden(t, base+limits.name+".completion.golden", append(out, '\n'))
+			})
+		}
+	}
+}
+
+// checkGolden 比较输出与 golden 文件，-update 时写入新的 golden 文件
+func checkGolden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file: %v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
@@ -0,0 +1,60 @@
+package monica
+
+import (
+	"context"
+	"io"
+
+	lop "github.com/samber/lo/parallel"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ChoiceStreams n>1 时每个 choice 对应的 Monica 响应流
+type ChoiceStreams []io.ReadCloser
+
+// Readers 转换为 StreamMonicaSSEToClient 的参数
+func (s ChoiceStreams) Readers() []io.Reader {
+	readers := make([]io.Reader, len(s))
+	for i, r := range s {
+		readers[i] = r
+	}
+	return readers
+}
+
+// Close 关闭所有响应流
+func (s ChoiceStreams) Close() error {
+	var firstErr error
+	for _, r := range s {
+		if err := r.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// CollectChoicesToCompletion 并行读取多个 Monica 响应流，合并为包含多个 choice 的 ChatCompletion 响应
+func CollectChoicesToCompletion(ctx context.Context, model string, limits OutputLimits, streams ChoiceStreams) (*openai.ChatCompletionResponse, error) {
+	type collectResult struct {
+		resp *openai.ChatCompletionResponse
+		err  error
+	}
+	results := lop.Map(streams, func(r io.ReadCloser, _ int) collectResult {
+		resp, err := CollectMonicaSSEToCompletion(ctx, model, limits, r)
+		return collectResult{resp: resp, err: err}
+	})
+
+	var response *openai.ChatCompletionResponse
+	for i, result := range results {
+		if result.err != nil {
+			return nil, result.err
+		}
+		choice := result.resp.Choices[0]
+		choice.Index = i
+		if response == nil {
+			response = result.resp
+			response.Choices = []openai.ChatCompletionChoice{choice}
+			continue
+		}
+		response.Choices = append(response.Choices, choice)
+	}
+	return response, nil
+}
@@ -2,18 +2,33 @@ package monica
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"monica-proxy/internal/audit"
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/errors"
 	"monica-proxy/internal/logger"
+	"monica-proxy/internal/redact"
+	"monica-proxy/internal/tracing"
 	"monica-proxy/internal/types"
 	"monica-proxy/internal/utils"
 
 	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+// maxErrorBodySize 流式请求失败时读取的响应体大小上限
+const maxErrorBodySize = 4096
+
 // SendMonicaRequest 发起对 Monica AI 的请求(使用 resty)
 func SendMonicaRequest(ctx context.Context, cfg *config.Config, mReq *types.MonicaRequest) (*resty.Response, error) {
+	ctx, span := tracing.StartClient(ctx, "monica.chat",
+		attribute.String("url.full", types.BotChatURL),
+		attribute.String("monica.task_uid", mReq.TaskUID),
+		attribute.String("monica.bot_uid", mReq.BotUID),
+	)
 	// Логируем детали запроса
 	logger.Info("Отправка HTTP запроса к Monica API",
 		zap.String("url", types.BotChatURL),
@@ -31,13 +46,8 @@ func SendMonicaRequest(ctx context.Context, cfg *config.Config, mReq *types.Moni
 		SetHeader("x-client-locale", "ru_RU"). // Явно устанавливаем русский язык
 		SetBody(mReq)
 
-	// Логируем все заголовки перед отправкой
-	headers := make(map[string]string)
-	for k, v := range req.Header {
-		if len(v) > 0 {
-			headers[k] = v[0]
-		}
-	}
+	// Логируем все заголовки перед отправкой, cookie скрывается
+	headers := redact.Headers(req.Header)
 	logger.Info("Финальные HTTP заголовки перед отправкой в Monica",
 		zap.Any("all_headers", headers),
 		zap.String("x_client_locale_value", headers["X-Client-Locale"]),
@@ -45,12 +55,18 @@ func SendMonicaRequest(ctx context.Context, cfg *config.Config, mReq *types.Moni
 	)
 
 	// 发起请求
+	audit.FromContext(ctx).AddUpstreamRequest(mReq)
 	resp, err := req.Post(types.BotChatURL)
+	if err == nil {
+		err = checkStreamStatus(resp)
+	}
+	endRequestSpan(span, resp, err)
 
 	if err != nil {
-		logger.Error("Monica API请求失败", zap.Error(err))
+		logger.Error("Monica API请求失败", redact.Error(err))
 		return nil, errors.NewRequestFailedError("Monica API调用失败", err)
 	}
+	captureResponse(cfg, "chat", mReq.TaskUID, resp)
 
 	// 如果需要在这里做更多判断，可自行补充
 	return resp, nil
@@ -58,6 +74,11 @@ func SendMonicaRequest(ctx context.Context, cfg *config.Config, mReq *types.Moni
 
 // SendCustomBotRequest 发送custom bot请求
 func SendCustomBotRequest(ctx context.Context, cfg *config.Config, customBotReq *types.CustomBotRequest) (*resty.Response, error) {
+	ctx, span := tracing.StartClient(ctx, "monica.custom_bot_chat",
+		attribute.String("url.full", types.CustomBotChatURL),
+		attribute.String("monica.task_uid", customBotReq.TaskUID),
+		attribute.String("monica.bot_uid", customBotReq.BotUID),
+	)
 	// Логируем детали запроса
 	logger.Info("Отправка HTTP запроса к Monica Custom Bot API",
 		zap.String("url", types.CustomBotChatURL),
@@ -77,13 +98,8 @@ func SendCustomBotRequest(ctx context.Context, cfg *config.Config, customBotReq
 		SetHeader("x-client-locale", "ru_RU"). // Явно устанавливаем русский язык
 		SetBody(customBotReq)
 
-	// Логируем все заголовки перед отправкой
-	headers := make(map[string]string)
-	for k, v := range req.Header {
-		if len(v) > 0 {
-			headers[k] = v[0]
-		}
-	}
+	// Логируем все заголовки перед отправкой, cookie скрывается
+	headers := redact.Headers(req.Header)
 	logger.Info("Финальные HTTP заголовки Custom Bot перед отправкой в Monica",
 		zap.Any("all_headers", headers),
 		zap.String("x_client_locale_value", headers["X-Client-Locale"]),
@@ -91,12 +107,38 @@ func SendCustomBotRequest(ctx context.Context, cfg *config.Config, customBotReq
 	)
 
 	// 发起请求
+	audit.FromContext(ctx).AddUpstreamRequest(customBotReq)
 	resp, err := req.Post(types.CustomBotChatURL)
+	if err == nil {
+		err = checkStreamStatus(resp)
+	}
+	endRequestSpan(span, resp, err)
 
 	if err != nil {
-		logger.Error("Custom Bot API请求失败", zap.Error(err))
+		logger.Error("Custom Bot API请求失败", redact.Error(err))
 		return nil, errors.NewRequestFailedError("Custom Bot API调用失败", err)
 	}
+	captureResponse(cfg, "custom_bot", customBotReq.TaskUID, resp)
 
 	return resp, nil
 }
+
+// checkStreamStatus 流式请求不解析响应，客户端的 OnAfterResponse 不会检查状态码
+// 状态码不是 2xx 时读取部分响应体作为错误信息并关闭响应
+func checkStreamStatus(resp *resty.Response) error {
+	if resp.IsSuccess() {
+		return nil
+	}
+	body := resp.RawBody()
+	defer body.Close()
+	data, _ := io.ReadAll(io.LimitReader(body, maxErrorBodySize))
+	return fmt.Errorf("monica API error: status %d, body: %s", resp.StatusCode(), redact.Body(data))
+}
+
+// endRequestSpan 记录响应状态码并结束请求 span，响应体的读取由流式处理的 span 记录
+func endRequestSpan(span trace.Span, resp *resty.Response, err error) {
+	if resp != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode()))
+	}
+	tracing.End(span, err)
+}
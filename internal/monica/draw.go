@@ -3,6 +3,8 @@ package monica
 import (
 	"context"
 	"fmt"
+	"io"
+	"monica-proxy/internal/audit"
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/types"
 	"monica-proxy/internal/utils"
@@ -10,8 +12,20 @@ import (
 
 	"github.com/bytedance/sonic"
 	"github.com/google/uuid"
+	lop "github.com/samber/lo/parallel"
 )
 
+// ImageProgressFunc 图片任务进度回调，elapsed 为已等待的时间，expected 为 Monica 预计的生成时间
+type ImageProgressFunc func(elapsed, expected time.Duration)
+
+// imageProgressKey 进度回调在 context 中的 key
+type imageProgressKey struct{}
+
+// WithImageProgress 返回带有进度回调的 context，图片任务轮询时会调用该回调
+func WithImageProgress(ctx context.Context, fn ImageProgressFunc) context.Context {
+	return context.WithValue(ctx, imageProgressKey{}, fn)
+}
+
 // GenerateImage 使用 Monica 的文生图 API 生成图片
 func GenerateImage(ctx context.Context, cfg *config.Config, req *types.ImageGenerationRequest) (*types.ImageGenerationResponse, error) {
 	// 1. 参数验证和默认值设置
@@ -25,31 +39,60 @@ func GenerateImage(ctx context.Context, cfg *config.Config, req *types.ImageGene
 		req.Size = "1024x1024" // 默认尺寸
 	}
 
-	// 2. 转换尺寸为 Monica 的格式
-	aspectRatio := sizeToAspectRatio(req.Size)
-
-	// 3. 构建请求体
+	// 2. 转换尺寸、模型和提示词为 Monica 的格式
 	monicaReq := &types.MonicaImageRequest{
-		TaskUID:     uuid.New().String(),
-		ImageCount:  req.N,
-		Prompt:      req.Prompt,
-		ModelType:   "sdxl", // Monica 目前只支持 sdxl
-		AspectRatio: aspectRatio,
-		TaskType:    "text_to_image",
+		Prompt:      applyPromptModifiers(req.Prompt, req.Quality, req.Style),
+		ModelType:   imageModelType(cfg, req.Model),
+		AspectRatio: sizeToAspectRatio(req.Size),
+		TaskType:    types.ImageTaskTextToImage,
 	}
 
-	// 4. 发送请求生成图片
+	// 3. 提交任务并轮询结果
+	return runImageTasks(ctx, cfg, types.ImageGenerateURL, monicaReq, req.N)
+}
+
+// runImageTasks 按单次任务的图片数量上限拆分为多个任务并行执行，合并生成结果
+// 任一任务失败时返回错误
+func runImageTasks(ctx context.Context, cfg *config.Config, submitURL string, base *types.MonicaImageRequest, n int) (*types.ImageGenerationResponse, error) {
+	counts := splitImageCount(n, cfg.Image.MaxImagesPerCall)
+
+	type taskResult struct {
+		resp *types.ImageGenerationResponse
+		err  error
+	}
+	results := lop.Map(counts, func(count int, _ int) taskResult {
+		monicaReq := *base
+		monicaReq.TaskUID = uuid.New().String()
+		monicaReq.ImageCount = count
+		resp, err := runImageTask(ctx, cfg, submitURL, &monicaReq)
+		return taskResult{resp: resp, err: err}
+	})
+
+	response := &types.ImageGenerationResponse{Created: time.Now().Unix()}
+	for _, result := range results {
+		if result.err != nil {
+			return nil, result.err
+		}
+		response.Data = append(response.Data, result.resp.Data...)
+	}
+	return response, nil
+}
+
+// runImageTask 提交图片工具任务，然后通过 loop_result 轮询直到生成完成
+func runImageTask(ctx context.Context, cfg *config.Config, submitURL string, monicaReq *types.MonicaImageRequest) (*types.ImageGenerationResponse, error) {
+	// 1. 发送请求提交任务
+	audit.FromContext(ctx).AddUpstreamRequest(monicaReq)
 	resp, err := utils.RestyDefaultClient.R().
 		SetContext(ctx).
 		SetBody(monicaReq).
 		SetHeader("cookie", cfg.Monica.Cookie).
-		Post(types.ImageGenerateURL)
+		Post(submitURL)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to send image generation request: %v", err)
+		return nil, fmt.Errorf("failed to send %s request: %v", monicaReq.TaskType, err)
 	}
 
-	// 5. 解析响应
+	// 2. 解析响应
 	var monicaResp struct {
 		Code int    `json:"code"`
 		Msg  string `json:"msg"`
@@ -60,90 +103,126 @@ func GenerateImage(ctx context.Context, cfg *config.Config, req *types.ImageGene
 	}
 
 	if err := sonic.Unmarshal(resp.Body(), &monicaResp); err != nil {
-		return nil, fmt.Errorf("failed to parse image generation response: %v", err)
+		return nil, fmt.Errorf("failed to parse %s response: %v", monicaReq.TaskType, err)
 	}
 
 	if monicaResp.Code != 0 {
-		return nil, fmt.Errorf("image generation failed: %s", monicaResp.Msg)
+		return nil, fmt.Errorf("%s failed: %s", monicaReq.TaskType, monicaResp.Msg)
 	}
 
-	// 6. 轮询获取生成结果
+	// 3. 轮询获取生成结果
 	imageToolsID := monicaResp.Data.ImageToolsID
 	expectedTime := monicaResp.Data.ExpectedTime
+	if expectedTime <= 0 {
+		expectedTime = defaultImageExpectedTime
+	}
 
 	// 设置轮询超时时间为预期时间的2倍
 	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(expectedTime*2)*time.Second)
 	defer cancel()
 
+	progress, _ := ctx.Value(imageProgressKey{}).(ImageProgressFunc)
+	startedAt := time.Now()
+
 	var generatedImages []types.ImageGenerationData
 	for {
-		select {
-		case <-timeoutCtx.Done():
-			return nil, fmt.Errorf("timeout waiting for image generation")
-		default:
-			var resultData struct {
-				Code int    `json:"code"`
-				Msg  string `json:"msg"`
-				Data struct {
-					Record struct {
-						Result struct {
-							CDNURLList []string `json:"cdn_url_list"`
-						} `json:"result"`
-					} `json:"record"`
-				} `json:"data"`
-			}
+		var resultData struct {
+			Code int    `json:"code"`
+			Msg  string `json:"msg"`
+			Data struct {
+				Record struct {
+					Result struct {
+						CDNURLList []string `json:"cdn_url_list"`
+					} `json:"result"`
+				} `json:"record"`
+			} `json:"data"`
+		}
 
-			// 查询生成结果
-			_, err := utils.RestyDefaultClient.R().
-				SetContext(ctx).
-				SetBody(map[string]any{
-					"image_tools_id": imageToolsID,
-				}).
-				SetHeader("cookie", cfg.Monica.Cookie).
-				SetResult(&resultData).
-				Post(types.ImageResultURL)
-
-			if err != nil {
-				return nil, fmt.Errorf("failed to get image generation result: %v", err)
+		// 查询生成结果
+		_, err := utils.RestyDefaultClient.R().
+			SetContext(timeoutCtx).
+			SetBody(map[string]any{
+				"image_tools_id": imageToolsID,
+			}).
+			SetHeader("cookie", cfg.Monica.Cookie).
+			SetResult(&resultData).
+			Post(types.ImageResultURL)
+
+		if err != nil {
+			if timeoutCtx.Err() != nil && ctx.Err() == nil {
+				return nil, fmt.Errorf("timeout waiting for %s", monicaReq.TaskType)
 			}
+			return nil, fmt.Errorf("failed to get image result: %v", err)
+		}
 
-			if resultData.Code != 0 {
-				return nil, fmt.Errorf("failed to get image result: %s", resultData.Msg)
-			}
+		if resultData.Code != 0 {
+			return nil, fmt.Errorf("failed to get image result: %s", resultData.Msg)
+		}
 
-			// 检查是否有图片生成完成
-			if len(resultData.Data.Record.Result.CDNURLList) > 0 {
-				// 构建返回数据
-				for _, url := range resultData.Data.Record.Result.CDNURLList {
-					generatedImages = append(generatedImages, types.ImageGenerationData{
-						URL:           url,
-						RevisedPrompt: req.Prompt, // Monica 不提供修改后的提示词
-					})
-				}
-
-				// 返回结果
-				return &types.ImageGenerationResponse{
-					Created: time.Now().Unix(),
-					Data:    generatedImages,
-				}, nil
+		// 检查是否有图片生成完成
+		if len(resultData.Data.Record.Result.CDNURLList) > 0 {
+			// 构建返回数据
+			for _, url := range resultData.Data.Record.Result.CDNURLList {
+				generatedImages = append(generatedImages, types.ImageGenerationData{
+					URL:           url,
+					RevisedPrompt: monicaReq.Prompt, // Monica 不提供修改后的提示词
+				})
 			}
 
-			// 等待一段时间后继续轮询
-			time.Sleep(time.Second)
+			// 返回结果
+			return &types.ImageGenerationResponse{
+				Created: time.Now().Unix(),
+				Data:    generatedImages,
+			}, nil
+		}
+
+		if progress != nil {
+			progress(time.Since(startedAt), time.Duration(expectedTime)*time.Second)
+		}
+
+		// 等待一段时间后继续轮询
+		select {
+		case <-timeoutCtx.Done():
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("timeout waiting for %s", monicaReq.TaskType)
+		case <-time.After(time.Second):
 		}
 	}
 }
 
-// sizeToAspectRatio 将 OpenAI 的尺寸格式转换为 Monica 的宽高比格式
-func sizeToAspectRatio(size string) string {
-	switch size {
-	case "1024x1024":
-		return "1:1"
-	case "1792x1024":
-		return "16:9"
-	case "1024x1792":
-		return "9:16"
-	default:
-		return "1:1" // 默认使用1:1
+const (
+	// maxGeneratedImageSize 下载生成图片的最大字节数
+	maxGeneratedImageSize = 20 * 1024 * 1024
+	// defaultImageExpectedTime Monica 未返回预期时间时使用的默认值（秒）
+	defaultImageExpectedTime = 60
+)
+
+// DownloadImage 从 Monica CDN 下载生成的图片
+func DownloadImage(ctx context.Context, url string) ([]byte, error) {
+	resp, err := utils.RestyDefaultClient.R().
+		SetContext(ctx).
+		SetDoNotParseResponse(true).
+		Get(url)
+	// 出错时 resty 也可能返回已打开的响应体，需要先关闭
+	if resp != nil && resp.RawBody() != nil {
+		defer resp.RawBody().Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image: %v", err)
+	}
+
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("failed to download image: status %d", resp.StatusCode())
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.RawBody(), maxGeneratedImageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %v", err)
+	}
+	if len(data) > maxGeneratedImageSize {
+		return nil, fmt.Errorf("image size exceeds limit: %d", maxGeneratedImageSize)
 	}
+	return data, nil
 }
@@ -0,0 +1,110 @@
+package monica
+
+import (
+	"math"
+	"monica-proxy/internal/config"
+	"strconv"
+	"strings"
+)
+
+// aspectRatio Monica 支持的宽高比
+type aspectRatio struct {
+	name  string
+	value float64
+}
+
+// supportedAspectRatios Monica 图片工具支持的宽高比
+var supportedAspectRatios = []aspectRatio{
+	{"1:1", 1},
+	{"4:3", 4.0 / 3},
+	{"3:4", 3.0 / 4},
+	{"3:2", 3.0 / 2},
+	{"2:3", 2.0 / 3},
+	{"16:9", 16.0 / 9},
+	{"9:16", 9.0 / 16},
+	{"21:9", 21.0 / 9},
+	{"9:21", 9.0 / 21},
+}
+
+// qualityModifiers quality 参数对应追加到提示词的描述，Monica 没有对应的选项
+var qualityModifiers = map[string]string{
+	"hd":   "highly detailed, sharp focus, high resolution",
+	"high": "highly detailed, sharp focus, high resolution",
+}
+
+// styleModifiers style 参数对应追加到提示词的描述
+var styleModifiers = map[string]string{
+	"vivid":   "vivid colors, dramatic lighting, hyper-real",
+	"natural": "natural lighting, realistic, muted colors",
+}
+
+// sizeToAspectRatio 将 OpenAI 的尺寸格式 (WxH) 转换为最接近的 Monica 宽高比
+// 也接受直接传入的宽高比 (W:H)，无法解析时使用 1:1
+func sizeToAspectRatio(size string) string {
+	var sep string
+	switch {
+	case strings.Contains(size, "x"):
+		sep = "x"
+	case strings.Contains(size, ":"):
+		sep = ":"
+	default:
+		return "1:1"
+	}
+
+	w, h, ok := strings.Cut(size, sep)
+	if !ok {
+		return "1:1"
+	}
+	width, err1 := strconv.ParseFloat(strings.TrimSpace(w), 64)
+	height, err2 := strconv.ParseFloat(strings.TrimSpace(h), 64)
+	if err1 != nil || err2 != nil || width <= 0 || height <= 0 {
+		return "1:1"
+	}
+
+	// 按对数比较，使 2:1 和 1:2 与 1:1 的距离相同
+	target := math.Log(width / height)
+	best := supportedAspectRatios[0]
+	for _, ratio := range supportedAspectRatios[1:] {
+		if math.Abs(math.Log(ratio.value)-target) < math.Abs(math.Log(best.value)-target) {
+			best = ratio
+		}
+	}
+	return best.name
+}
+
+// imageModelType 将 OpenAI 的模型名映射为 Monica 的 model_type
+func imageModelType(cfg *config.Config, model string) string {
+	if modelType, ok := cfg.Image.ModelTypes[model]; ok && modelType != "" {
+		return modelType
+	}
+	return cfg.Image.DefaultModelType
+}
+
+// applyPromptModifiers 将 quality 和 style 转换为提示词描述追加到提示词后
+func applyPromptModifiers(prompt, quality, style string) string {
+	var modifiers []string
+	if modifier, ok := qualityModifiers[strings.ToLower(quality)]; ok {
+		modifiers = append(modifiers, modifier)
+	}
+	if modifier, ok := styleModifiers[strings.ToLower(style)]; ok {
+		modifiers = append(modifiers, modifier)
+	}
+	if len(modifiers) == 0 {
+		return prompt
+	}
+	return strings.TrimRight(prompt, " ,.") + ", " + strings.Join(modifiers, ", ")
+}
+
+// splitImageCount 按单次任务的上限拆分图片数量
+func splitImageCount(n, perCall int) []int {
+	if perCall <= 0 {
+		return []int{n}
+	}
+	var counts []int
+	for n > 0 {
+		count := min(n, perCall)
+		counts = append(counts, count)
+		n -= count
+	}
+	return counts
+}
@@ -0,0 +1,119 @@
+package monica
+
+import (
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/utils"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// OutputLimits 输出限制，Monica 不支持 stop 和 max_tokens，由代理在转换响应时执行
+// 只作用于回复正文，思考过程（流式输出中的 <think> 内容）不计入 max_tokens，也不匹配停止序列
+type OutputLimits struct {
+	Stop      []string // 停止序列，输出遇到任意一个时截断
+	MaxTokens int      // 最大输出 token 数（估算），0 表示不限制
+}
+
+// NewOutputLimits 从请求中提取输出限制，max_completion_tokens 优先于 max_tokens
+func NewOutputLimits(req *types.ChatCompletionRequest) OutputLimits {
+	limits := OutputLimits{MaxTokens: req.MaxTokens}
+	if req.MaxCompletionTokens > 0 {
+		limits.MaxTokens = req.MaxCompletionTokens
+	}
+	for _, stop := range req.Stop {
+		if stop != "" {
+			limits.Stop = append(limits.Stop, stop)
+		}
+	}
+	return limits
+}
+
+// outputLimiter 对单个 choice 的输出执行限制
+// 可能是停止序列开头的文本会先保留，直到能确定是否匹配，以处理跨数据块的停止序列
+type outputLimiter struct {
+	limits       OutputLimits
+	tokens       utils.TokenEstimator
+	pending      string
+	finishReason openai.FinishReason
+}
+
+// newOutputLimiter 创建输出限制器
+func newOutputLimiter(limits OutputLimits) *outputLimiter {
+	return &outputLimiter{limits: limits}
+}
+
+// done 是否已经达到限制
+func (l *outputLimiter) done() bool {
+	return l.finishReason != ""
+}
+
+// push 输入新生成的文本，返回可以输出的部分
+func (l *outputLimiter) push(text string) string {
+	if l.done() {
+		return ""
+	}
+	buf := l.pending + text
+	l.pending = ""
+
+	// 截断到最先出现的停止序列
+	if idx := l.firstStop(buf); idx >= 0 {
+		out := l.take(buf[:idx])
+		if !l.done() {
+			l.finishReason = openai.FinishReasonStop
+		}
+		return out
+	}
+
+	// 保留结尾可能是停止序列开头的部分
+	hold := l.stopPrefixLen(buf)
+	l.pending = buf[len(buf)-hold:]
+	return l.take(buf[:len(buf)-hold])
+}
+
+// flush 流结束时输出保留的文本
+func (l *outputLimiter) flush() string {
+	if l.done() {
+		return ""
+	}
+	text := l.pending
+	l.pending = ""
+	return l.take(text)
+}
+
+// take 按 token 上限截断输出
+func (l *outputLimiter) take(text string) string {
+	if l.limits.MaxTokens <= 0 {
+		return text
+	}
+	text, truncated := l.tokens.Take(text, l.limits.MaxTokens)
+	if truncated {
+		l.finishReason = openai.FinishReasonLength
+	}
+	return text
+}
+
+// firstStop 返回最先出现的停止序列的位置，没有时返回 -1
+func (l *outputLimiter) firstStop(s string) int {
+	first := -1
+	for _, stop := range l.limits.Stop {
+		if idx := strings.Index(s, stop); idx >= 0 && (first < 0 || idx < first) {
+			first = idx
+		}
+	}
+	return first
+}
+
+// stopPrefixLen 返回 s 结尾与任意停止序列开头相同的最长长度
+func (l *outputLimiter) stopPrefixLen(s string) int {
+	longest := 0
+	for _, stop := range l.limits.Stop {
+		for n := min(len(stop)-1, len(s)); n > longest; n-- {
+			if strings.HasSuffix(s, stop[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
@@ -0,0 +1,167 @@
+package monica
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"monica-proxy/internal/types"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// monicaSSE 构造 Monica SSE 响应体，每个参数为一个 text 数据块
+func monicaSSE(chunks ...string) string {
+	return monicaText(chunks...) + `data: {"text":"","finished":true}` + "\n\n"
+}
+
+// monicaText 构造不带 finished 标记的 text 数据块
+func monicaText(chunks ...string) string {
+	var sb strings.Builder
+	for _, chunk := range chunks {
+		line, _ := json.Marshal(map[string]string{"text": chunk})
+		sb.WriteString("data: " + string(line) + "\n\n")
+	}
+	return sb.String()
+}
+
+// parseStream 解析写给客户端的 SSE，返回数据块和 [DONE] 的个数
+func parseStream(t *testing.T, out string) ([]types.ChatCompletionStreamResponse, int) {
+	t.Helper()
+	var chunks []types.ChatCompletionStreamResponse
+	done := 0
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done++
+			continue
+		}
+		var chunk types.ChatCompletionStreamResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("invalid chunk %q: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, done
+}
+
+// streamContent 拼接指定 choice 的内容，返回内容和最后的 finish_reason
+func streamContent(chunks []types.ChatCompletionStreamResponse, index int) (string, openai.FinishReason) {
+	var sb strings.Builder
+	var finishReason openai.FinishReason
+	for _, chunk := range chunks {
+		for _, choice := range chunk.Choices {
+			if choice.Index != index {
+				continue
+			}
+			sb.WriteString(choice.Delta.Content)
+			if choice.FinishReason != openai.FinishReasonNull && choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+		}
+	}
+	return sb.String(), finishReason
+}
+
+func TestOutputLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		limits     OutputLimits
+		body       string
+		want       string
+		wantStream string // 流式输出的内容，为空时与 want 相同
+		wantFinish openai.FinishReason
+	}{
+		{
+			name:       "stop split across chunks",
+			limits:     OutputLimits{Stop: []string{"END"}},
+			body:       monicaSSE("Hello E", "ND world"),
+			want:       "Hello ",
+			wantFinish: openai.FinishReasonStop,
+		},
+		{
+			name:       "stop at first byte",
+			limits:     OutputLimits{Stop: []string{"STOP"}},
+			body:       monicaSSE("STOP here"),
+			want:       "",
+			wantFinish: openai.FinishReasonStop,
+		},
+		{
+			name:       "held stop prefix flushed at end",
+			limits:     OutputLimits{Stop: []string{"xyz"}},
+			body:       monicaSSE("ab", "cx"),
+			want:       "abcx",
+			wantFinish: openai.FinishReasonStop,
+		},
+		{
+			name:       "max tokens",
+			limits:     OutputLimits{MaxTokens: 2},
+			body:       monicaSSE("abcde", "fghij"),
+			want:       "abcdefgh",
+			wantFinish: openai.FinishReasonLength,
+		},
+		{
+			name:       "max tokens with CJK",
+			limits:     OutputLimits{MaxTokens: 3},
+			body:       monicaSSE("你好", "世界"),
+			want:       "你好世",
+			wantFinish: openai.FinishReasonLength,
+		},
+		{
+			name:       "exactly max tokens",
+			limits:     OutputLimits{MaxTokens: 2},
+			body:       monicaSSE("abcd", "efgh"),
+			want:       "abcdefgh",
+			wantFinish: openai.FinishReasonStop,
+		},
+		{
+			name:       "stop before max tokens",
+			limits:     OutputLimits{Stop: []string{"\n"}, MaxTokens: 2},
+			body:       monicaSSE("ab\ncdefghij"),
+			want:       "ab",
+			wantFinish: openai.FinishReasonStop,
+		},
+		{
+			name:   "reasoning not counted",
+			limits: OutputLimits{MaxTokens: 1},
+			body: `data: {"agent_status":{"type":"thinking"}}` + "\n\n" +
+				`data: {"agent_status":{"type":"thinking_detail_stream","metadata":{"reasoning_detail":"a long line of reasoning"}}}` + "\n\n" +
+				monicaSSE("abcd"),
+			want:       "abcd",
+			wantStream: "<think>a long line of reasoning</think>abcd",
+			wantFinish: openai.FinishReasonStop,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completion, err := CollectMonicaSSEToCompletion(context.Background(), "gpt-4o", tt.limits, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("CollectMonicaSSEToCompletion() error = %v", err)
+			}
+			choice := completion.Choices[0]
+			if choice.Message.Content != tt.want || choice.FinishReason != tt.wantFinish {
+				t.Errorf("completion = %q (%s), want %q (%s)", choice.Message.Content, choice.FinishReason, tt.want, tt.wantFinish)
+			}
+
+			var out strings.Builder
+			if err := StreamMonicaSSEToClient(context.Background(), "gpt-4o", &out, tt.limits, strings.NewReader(tt.body)); err != nil {
+				t.Fatalf("StreamMonicaSSEToClient() error = %v", err)
+			}
+			chunks, _ := parseStream(t, out.String())
+			wantStream := tt.wantStream
+			if wantStream == "" {
+				wantStream = tt.want
+			}
+			content, finishReason := streamContent(chunks, 0)
+			if content != wantStream || finishReason != tt.wantFinish {
+				t.Errorf("stream = %q (%s), want %q (%s)", content, finishReason, wantStream, tt.wantFinish)
+			}
+		})
+	}
+}
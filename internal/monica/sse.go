@@ -10,6 +10,11 @@ import (
 	"sync"
 	"time"
 
+	"monica-proxy/internal/audit"
+	"monica-proxy/internal/inflight"
+	"monica-proxy/internal/logger"
+	"monica-proxy/internal/metrics"
+	"monica-proxy/internal/tracing"
 	"monica-proxy/internal/types"
 	"monica-proxy/internal/utils"
 	"net/http"
@@ -17,6 +22,8 @@ import (
 
 	"github.com/bytedance/sonic"
 	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
 )
 
 const (
@@ -142,8 +149,8 @@ func (p *processMonicaSSE) processSSEStream(handler handleSSEData) error {
 }
 
 // CollectMonicaSSEToCompletion 将 Monica SSE 转换为完整的 ChatCompletion 响应
-func CollectMonicaSSEToCompletion(model string, r io.Reader) (*openai.ChatCompletionResponse, error) {
-	ctx := context.Background()
+// 达到输出限制时停止读取，由调用方关闭响应体以结束上游请求，请求被取消时返回已经生成的内容
+func CollectMonicaSSEToCompletion(ctx context.Context, model string, limits OutputLimits, r io.Reader) (*openai.ChatCompletionResponse, error) {
 	
 	// 从池中获取字符串构建器
 	fullContentBuilder := stringBuilderPool.Get().(*strings.Builder)
@@ -158,6 +165,8 @@ func CollectMonicaSSEToCompletion(model string, r io.Reader) (*openai.ChatComple
 		ctx:    ctx,
 	}
 
+	limiter := newOutputLimiter(limits)
+
 	// 处理SSE数据
 	err := processor.processSSEStream(func(sseData *SSEData) error {
 		// 如果是 agent_status，跳过
@@ -165,19 +174,36 @@ func CollectMonicaSSEToCompletion(model string, r io.Reader) (*openai.ChatComple
 			return nil
 		}
 		// 累积内容
-		fullContentBuilder.WriteString(sseData.Text)
+		fullContentBuilder.WriteString(limiter.push(sseData.Text))
+		if limiter.done() {
+			return errStreamStopped
+		}
 		return nil
 	})
+	cancelled := inflight.Cancelled(ctx)
+	if errors.Is(err, errStreamStopped) || cancelled {
+		err = nil
+	}
 
 	if err != nil {
 		return nil, err
 	}
 
+	fullContentBuilder.WriteString(limiter.flush())
+	finishReason := openai.FinishReasonStop
+	switch {
+	case limiter.done():
+		finishReason = limiter.finishReason
+	case cancelled:
+		finishReason = FinishReasonCancelled
+	}
+
 	// 构造完整的响应
+	meta := newStreamMeta(ctx)
 	response := &openai.ChatCompletionResponse{
-		ID:      fmt.Sprintf("chatcmpl-%s", utils.RandStringUsingMathRand(29)),
+		ID:      meta.id,
 		Object:  "chat.completion",
-		Created: time.Now().Unix(),
+		Created: meta.created,
 		Model:   model,
 		Choices: []openai.ChatCompletionChoice{
 			{
@@ -186,7 +212,7 @@ func CollectMonicaSSEToCompletion(model string, r io.Reader) (*openai.ChatComple
 					Role:    "assistant",
 					Content: fullContentBuilder.String(),
 				},
-				FinishReason: "stop",
+				FinishReason: finishReason,
 			},
 		},
 		Usage: openai.Usage{
@@ -201,158 +227,295 @@ func CollectMonicaSSEToCompletion(model string, r io.Reader) (*openai.ChatComple
 }
 
 // StreamMonicaSSEToClient 将 Monica SSE 转成前端可用的流
-func StreamMonicaSSEToClient(model string, w io.Writer, r io.Reader) error {
-	ctx := context.Background()
+// 传入多个流时（n>1）并行读取，每个流对应一个 choice，按到达顺序写给客户端
+// 此时单个 choice 读取失败以 cancelled 结束该 choice，其余 choice 继续输出，全部失败时才返回错误
+// 达到输出限制的 choice 会停止读取，由调用方关闭响应体以结束上游请求
+func StreamMonicaSSEToClient(ctx context.Context, model string, w io.Writer, limits OutputLimits, readers ...io.Reader) (err error) {
 	writer := bufio.NewWriterSize(w, bufferSize)
 	defer writer.Flush()
 
-	chatId := utils.RandStringUsingMathRand(29)
-	now := time.Now().Unix()
-	fingerprint := utils.RandStringUsingMathRand(10)
+	observer := metrics.StartStream(model)
+	defer observer.Done()
+
+	ctx, span := tracing.Start(ctx, "monica.stream",
+		attribute.String("gen_ai.request.model", model),
+		attribute.Int("choices", len(readers)),
+	)
+	defer func() { tracing.End(span, err) }()
+	firstToken := false
+
+	meta := newStreamMeta(ctx)
 
 	// 创建一个定时刷新的 ticker
 	ticker := time.NewTicker(flushInterval)
 	defer ticker.Stop()
 
-	// 创建一个 done channel 用于清理
-	done := make(chan struct{})
-	defer close(done)
-
-	// 启动一个 goroutine 定期刷新缓冲区
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				if f, ok := w.(http.Flusher); ok {
-					writer.Flush()
-					f.Flush()
+	// stop 在写入结束后通知读取流的 goroutine 退出
+	stop := make(chan struct{})
+	defer close(stop)
+
+	chunks := make(chan *types.ChatCompletionStreamResponse, len(readers))
+	results := make(chan choiceResult, len(readers))
+	for i, r := range readers {
+		go func(index int, r io.Reader) {
+			finished, err := streamChoice(ctx, model, meta, limits, index, r, chunks, stop)
+			result := choiceResult{index: index, finished: finished, err: err}
+			if err != nil && len(readers) > 1 && ctx.Err() == nil {
+				logger.Warn("choice 读取失败，以 cancelled 结束", zap.Int("index", index), zap.Error(err))
+				select {
+				case chunks <- newStreamChunk(model, meta, index, "", FinishReasonCancelled):
+					result.finished, result.failed = true, true
+				case <-stop:
 				}
-			case <-done:
-				return
+			}
+			results <- result
+		}(i, r)
+	}
+
+	// 所有 choice 都收到 finished 时才发送 [DONE]
+	pending, allFinished := len(readers), true
+	finished := make([]bool, len(readers))
+	var firstErr error
+	failed := 0
+	for pending > 0 {
+		select {
+		case sseMsg := <-chunks:
+			if err := writeStreamChunk(writer, sseMsg); err != nil {
+				return err
+			}
+			observer.FirstToken()
+			if !firstToken {
+				firstToken = true
+				span.AddEvent("first_token")
+			}
+		case result := <-results:
+			pending--
+			finished[result.index] = result.finished
+			allFinished = allFinished && result.finished
+			if result.failed {
+				failed++
+			}
+			if result.err != nil && firstErr == nil {
+				firstErr = result.err
+			}
+		case <-ticker.C:
+			if f, ok := w.(http.Flusher); ok {
+				writer.Flush()
+				f.Flush()
 			}
 		}
-	}()
+	}
+
+	// 写出结束前已经产生但还未写入的数据
+	for len(chunks) > 0 {
+		if err := writeStreamChunk(writer, <-chunks); err != nil {
+			return err
+		}
+	}
+
+	// 请求被取消时为未结束的 choice 补充 cancelled 结束块，并正常结束响应
+	if inflight.Cancelled(ctx) {
+		for index, done := range finished {
+			if done {
+				continue
+			}
+			if err := writeStreamChunk(writer, newStreamChunk(model, meta, index, "", FinishReasonCancelled)); err != nil {
+				return err
+			}
+		}
+		span.SetAttributes(attribute.Bool("cancelled", true))
+		allFinished, firstErr = true, nil
+	}
+	if failed > 0 && failed < len(readers) {
+		span.SetAttributes(attribute.Int("failed_choices", failed))
+		firstErr = nil
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+
+	span.SetAttributes(attribute.Bool("finished", allFinished))
+	if allFinished {
+		writer.WriteString(dataPrefix)
+		writer.WriteString(sseFinish)
+		writer.WriteString(lineEnd)
+	}
+	writer.Flush()
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// streamMeta 同一个响应中所有数据块共用的字段
+type streamMeta struct {
+	id          string
+	created     int64
+	fingerprint string
+}
+
+// choiceResult 单个 choice 流的读取结果，failed 表示读取失败后已经以 cancelled 结束
+type choiceResult struct {
+	index    int
+	finished bool
+	failed   bool
+	err      error
+}
+
+// errStreamStopped 客户端写入结束后停止读取
+var errStreamStopped = errors.New("stream stopped")
+
+// FinishReasonCancelled 请求被取消时的结束原因，OpenAI 没有对应的值
+const FinishReasonCancelled openai.FinishReason = "cancelled"
+
+// ResponseMeta 固定响应的 ID、创建时间和 system_fingerprint，离线重放时用于得到确定的输出
+type ResponseMeta struct {
+	ID          string
+	Created     int64
+	Fingerprint string
+}
+
+// responseMetaKey context 中保存 ResponseMeta 的键
+type responseMetaKey struct{}
+
+// WithResponseMeta 返回携带固定响应字段的 context
+func WithResponseMeta(ctx context.Context, meta ResponseMeta) context.Context {
+	return context.WithValue(ctx, responseMetaKey{}, meta)
+}
+
+// newStreamMeta 创建响应共用的字段，context 中有 ResponseMeta 时使用固定值
+func newStreamMeta(ctx context.Context) streamMeta {
+	if meta, ok := ctx.Value(responseMetaKey{}).(ResponseMeta); ok {
+		return streamMeta{id: meta.ID, created: meta.Created, fingerprint: meta.Fingerprint}
+	}
+	return streamMeta{
+		id:          completionID(ctx),
+		created:     time.Now().Unix(),
+		fingerprint: utils.RandStringUsingMathRand(10),
+	}
+}
 
+// completionID 生成响应ID，跟踪的请求使用请求ID，客户端可以用响应ID取消请求
+func completionID(ctx context.Context) string {
+	if req := inflight.FromContext(ctx); req != nil {
+		return "chatcmpl-" + req.ID
+	}
+	return "chatcmpl-" + utils.RandStringUsingMathRand(29)
+}
+
+// newStreamChunk 创建第 index 个 choice 的数据块
+func newStreamChunk(model string, meta streamMeta, index int, content string, finishReason openai.FinishReason) *types.ChatCompletionStreamResponse {
+	return &types.ChatCompletionStreamResponse{
+		ID:                meta.id,
+		Object:            sseObject,
+		SystemFingerprint: meta.fingerprint,
+		Created:           meta.created,
+		Model:             model,
+		Choices: []types.ChatCompletionStreamChoice{
+			{
+				Index: index,
+				Delta: openai.ChatCompletionStreamChoiceDelta{
+					Role:    openai.ChatMessageRoleAssistant,
+					Content: content,
+				},
+				FinishReason: finishReason,
+			},
+		},
+	}
+}
+
+// streamChoice 读取单个 Monica 流，转换为第 index 个 choice 的数据块发送到 chunks
+// 返回是否已经结束（收到 finished 标记或达到输出限制）
+func streamChoice(ctx context.Context, model string, meta streamMeta, limits OutputLimits, index int, r io.Reader, chunks chan<- *types.ChatCompletionStreamResponse, stop <-chan struct{}) (bool, error) {
 	processor := &processMonicaSSE{
 		reader: bufio.NewReaderSize(r, bufferSize),
 		model:  model,
 		ctx:    ctx,
 	}
+	limiter := newOutputLimiter(limits)
+	auditEntry := audit.FromContext(ctx)
+
+	send := func(content string, finishReason openai.FinishReason) error {
+		sseMsg := newStreamChunk(model, meta, index, content, finishReason)
+		select {
+		case chunks <- sseMsg:
+			auditEntry.AppendStreamText(index, content)
+			return nil
+		case <-stop:
+			return errStreamStopped
+		}
+	}
 
-	var thinkFlag bool
-	return processor.processSSEStream(func(sseData *SSEData) error {
-		var sseMsg types.ChatCompletionStreamResponse
+	var thinkFlag, finished bool
+	err := processor.processSSEStream(func(sseData *SSEData) error {
 		switch {
 		case sseData.Finished:
-			sseMsg = types.ChatCompletionStreamResponse{
-				ID:      "chatcmpl-" + chatId,
-				Object:  sseObject,
-				Created: now,
-				Model:   model,
-				Choices: []types.ChatCompletionStreamChoice{
-					{
-						Index: 0,
-						Delta: openai.ChatCompletionStreamChoiceDelta{
-							Role: openai.ChatMessageRoleAssistant,
-						},
-						FinishReason: openai.FinishReasonStop,
-					},
-				},
+			// 先输出保留的可能是停止序列开头的文本
+			if rest := limiter.flush(); rest != "" {
+				if err := send(rest, openai.FinishReasonNull); err != nil {
+					return err
+				}
 			}
+			finishReason := openai.FinishReasonStop
+			if limiter.done() {
+				finishReason = limiter.finishReason
+			}
+			if err := send("", finishReason); err != nil {
+				return err
+			}
+			// 如果发现 finished=true，这个 choice 就结束了
+			finished = true
+			return errStreamStopped
 		case sseData.AgentStatus.Type == "thinking":
 			thinkFlag = true
-			sseMsg = types.ChatCompletionStreamResponse{
-				ID:                "chatcmpl-" + chatId,
-				Object:            sseObject,
-				SystemFingerprint: fingerprint,
-				Created:           now,
-				Model:             model,
-				Choices: []types.ChatCompletionStreamChoice{
-					{
-						Index: 0,
-						Delta: openai.ChatCompletionStreamChoiceDelta{
-							Role:    openai.ChatMessageRoleAssistant,
-							Content: `<think>`,
-						},
-						FinishReason: openai.FinishReasonNull,
-					},
-				},
-			}
+			return send(`<think>`, openai.FinishReasonNull)
 		case sseData.AgentStatus.Type == "thinking_detail_stream":
-			sseMsg = types.ChatCompletionStreamResponse{
-				ID:                "chatcmpl-" + chatId,
-				Object:            sseObject,
-				SystemFingerprint: fingerprint,
-				Created:           now,
-				Model:             model,
-				Choices: []types.ChatCompletionStreamChoice{
-					{
-						Index: 0,
-						Delta: openai.ChatCompletionStreamChoiceDelta{
-							Role:    openai.ChatMessageRoleAssistant,
-							Content: sseData.AgentStatus.Metadata.ReasoningDetail,
-						},
-						FinishReason: openai.FinishReasonNull,
-					},
-				},
-			}
-		default:
-			if thinkFlag {
-				sseData.Text = "</think>" + sseData.Text
-				thinkFlag = false
-			}
-			sseMsg = types.ChatCompletionStreamResponse{
-				ID:                "chatcmpl-" + chatId,
-				Object:            sseObject,
-				SystemFingerprint: fingerprint,
-				Created:           now,
-				Model:             model,
-				Choices: []types.ChatCompletionStreamChoice{
-					{
-						Index: 0,
-						Delta: openai.ChatCompletionStreamChoiceDelta{
-							Role:    openai.ChatMessageRoleAssistant,
-							Content: sseData.Text,
-						},
-						FinishReason: openai.FinishReasonNull,
-					},
-				},
-			}
+			return send(sseData.AgentStatus.Metadata.ReasoningDetail, openai.FinishReasonNull)
 		}
 
-		// 从池中获取字符串构建器
-		sb := stringBuilderPool.Get().(*strings.Builder)
-		sb.WriteString("data: ")
-		sendLine, _ := sonic.MarshalString(sseMsg)
-		sb.WriteString(sendLine)
-		sb.WriteString("\n\n")
-
-		// 写入缓冲区
-		if _, err := writer.WriteString(sb.String()); err != nil {
-			// 归还字符串构建器到池中
-			sb.Reset()
-			stringBuilderPool.Put(sb)
-			return fmt.Errorf("write error: %w", err)
+		content := limiter.push(sseData.Text)
+		if thinkFlag {
+			content = "</think>" + content
+			thinkFlag = false
 		}
-		
-		// 使用完毕，归还字符串构建器到池中
-		sb.Reset()
-		stringBuilderPool.Put(sb)
-
-		// 如果发现 finished=true，就可以结束
-		if sseData.Finished {
-			writer.WriteString(dataPrefix)
-			writer.WriteString(sseFinish)
-			writer.WriteString(lineEnd)
-			writer.Flush()
-			if f, ok := w.(http.Flusher); ok {
-				f.Flush()
+		if content != "" {
+			if err := send(content, openai.FinishReasonNull); err != nil {
+				return err
 			}
-			return nil
 		}
 
-		sseData.AgentStatus.Type = ""
-		sseData.Finished = false
+		// 达到输出限制后不再等待 Monica 的 finished 标记
+		if limiter.done() {
+			if err := send("", limiter.finishReason); err != nil {
+				return err
+			}
+			finished = true
+			return errStreamStopped
+		}
 		return nil
 	})
+	if errors.Is(err, errStreamStopped) {
+		err = nil
+	}
+	return finished, err
+}
+
+// writeStreamChunk 将一个数据块按 SSE 格式写入缓冲区
+func writeStreamChunk(writer *bufio.Writer, sseMsg *types.ChatCompletionStreamResponse) error {
+	// 从池中获取字符串构建器
+	sb := stringBuilderPool.Get().(*strings.Builder)
+	defer func() {
+		sb.Reset()
+		stringBuilderPool.Put(sb)
+	}()
+
+	sb.WriteString(dataPrefix)
+	sendLine, _ := sonic.MarshalString(sseMsg)
+	sb.WriteString(sendLine)
+	sb.WriteString(lineEnd)
+
+	if _, err := writer.WriteString(sb.String()); err != nil {
+		return fmt.Errorf("write error: %w", err)
+	}
+	return nil
 }
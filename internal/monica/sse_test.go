@@ -0,0 +1,159 @@
+package monica
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// flushWriter 线程安全的 http.Flusher，只有刷新后的数据才能被读取
+type flushWriter struct {
+	mu      sync.Mutex
+	pending bytes.Buffer
+	flushed bytes.Buffer
+}
+
+func (w *flushWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.pending.Write(p)
+}
+
+func (w *flushWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flushed.Write(w.pending.Bytes())
+	w.pending.Reset()
+}
+
+func (w *flushWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flushed.String()
+}
+
+// waitFor 等待刷新的输出中出现 s
+func (w *flushWriter) waitFor(t *testing.T, s string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(w.String(), s) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %q", s)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// failingReader 读取完 data 后返回 err
+func failingReader(data string, err error) io.Reader {
+	return io.MultiReader(strings.NewReader(data), &errReader{err: err})
+}
+
+type errReader struct{ err error }
+
+func (r *errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestStreamMonicaSSEToClientInterleaved(t *testing.T) {
+	r0, w0 := io.Pipe()
+	r1, w1 := io.Pipe()
+	out := &flushWriter{}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- StreamMonicaSSEToClient(context.Background(), "gpt-4o", out, OutputLimits{}, r0, r1)
+	}()
+
+	// 交替写入两个流，每块都等到写给客户端后再写下一块
+	steps := []struct {
+		w    *io.PipeWriter
+		text string
+	}{
+		{w0, "a1"}, {w1, "b1"}, {w0, "a2"}, {w1, "b2"},
+	}
+	for _, step := range steps {
+		io.WriteString(step.w, monicaText(step.text))
+		out.waitFor(t, `"content":"`+step.text+`"`)
+	}
+	io.WriteString(w0, monicaSSE())
+	w0.Close()
+	if strings.Contains(out.String(), "[DONE]") {
+		t.Fatal("[DONE] sent before all choices finished")
+	}
+	io.WriteString(w1, monicaSSE())
+	w1.Close()
+
+	if err := <-errc; err != nil {
+		t.Fatalf("StreamMonicaSSEToClient() error = %v", err)
+	}
+	out.Flush()
+	chunks, done := parseStream(t, out.String())
+	if done != 1 || !strings.HasSuffix(out.String(), "data: [DONE]\n\n") {
+		t.Errorf("got %d [DONE], want exactly one at the end", done)
+	}
+
+	var indexes []int
+	for _, chunk := range chunks[:4] {
+		indexes = append(indexes, chunk.Choices[0].Index)
+	}
+	if want := []int{0, 1, 0, 1}; !slices.Equal(indexes, want) {
+		t.Errorf("chunk indexes = %v, want %v", indexes, want)
+	}
+	for index, want := range []string{"a1a2", "b1b2"} {
+		content, finishReason := streamContent(chunks, index)
+		if content != want || finishReason != openai.FinishReasonStop {
+			t.Errorf("choice %d = %q (%s), want %q (stop)", index, content, finishReason, want)
+		}
+	}
+}
+
+func TestStreamMonicaSSEToClientChoiceFailure(t *testing.T) {
+	readErr := errors.New("connection reset")
+	partial := monicaText("partial")
+
+	t.Run("one choice fails", func(t *testing.T) {
+		var out strings.Builder
+		err := StreamMonicaSSEToClient(context.Background(), "gpt-4o", &out, OutputLimits{},
+			strings.NewReader(monicaSSE("complete")), failingReader(partial, readErr))
+		if err != nil {
+			t.Fatalf("StreamMonicaSSEToClient() error = %v", err)
+		}
+		chunks, done := parseStream(t, out.String())
+		if done != 1 {
+			t.Errorf("got %d [DONE], want 1", done)
+		}
+		if content, finishReason := streamContent(chunks, 0); content != "complete" || finishReason != openai.FinishReasonStop {
+			t.Errorf("choice 0 = %q (%s), want %q (stop)", content, finishReason, "complete")
+		}
+		if content, finishReason := streamContent(chunks, 1); content != "partial" || finishReason != FinishReasonCancelled {
+			t.Errorf("choice 1 = %q (%s), want %q (cancelled)", content, finishReason, "partial")
+		}
+	})
+
+	t.Run("all choices fail", func(t *testing.T) {
+		var out strings.Builder
+		err := StreamMonicaSSEToClient(context.Background(), "gpt-4o", &out, OutputLimits{},
+			failingReader(partial, readErr), failingReader(partial, readErr))
+		if !errors.Is(err, readErr) {
+			t.Fatalf("StreamMonicaSSEToClient() error = %v, want %v", err, readErr)
+		}
+		if _, done := parseStream(t, out.String()); done != 0 {
+			t.Errorf("got %d [DONE], want 0", done)
+		}
+	})
+
+	t.Run("single choice fails", func(t *testing.T) {
+		var out strings.Builder
+		err := StreamMonicaSSEToClient(context.Background(), "gpt-4o", &out, OutputLimits{}, failingReader(partial, readErr))
+		if !errors.Is(err, readErr) {
+			t.Fatalf("StreamMonicaSSEToClient() error = %v, want %v", err, readErr)
+		}
+	})
+}
@@ -0,0 +1,231 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"monica-proxy/internal/config"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// Mask 替换敏感内容的占位符
+const Mask = "[REDACTED]"
+
+// sensitiveHeaders 需要隐藏值的请求头（小写）
+var sensitiveHeaders = map[string]bool{
+	"cookie":              true,
+	"set-cookie":          true,
+	"authorization":       true,
+	"proxy-authorization": true,
+	"x-api-key":           true,
+}
+
+// sensitiveQueryParams 需要隐藏值的 URL 参数（小写），主要是对象存储预签名地址的签名和凭证
+var sensitiveQueryParams = map[string]bool{
+	"x-amz-signature":      true,
+	"x-amz-credential":     true,
+	"x-amz-security-token": true,
+	"x-oss-signature":      true,
+	"x-oss-credential":     true,
+	"x-oss-security-token": true,
+	"ossaccesskeyid":       true,
+	"signature":            true,
+	"sig":                  true,
+	"policy":               true,
+	"token":                true,
+	"access_token":         true,
+	"api_key":              true,
+	"key":                  true,
+}
+
+// defaultFields 默认隐藏的 JSON 字段（小写），可通过配置追加
+var defaultFields = []string{
+	"cookie",
+	"authorization",
+	"token",
+	"access_token",
+	"refresh_token",
+	"api_key",
+	"password",
+	"secret",
+}
+
+var (
+	// bearerPattern 文本中的 Bearer Token
+	bearerPattern = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`)
+	// queryParamPattern 文本中 URL 的参数，值是否需要隐藏由 sensitiveQueryParams 决定
+	queryParamPattern = regexp.MustCompile(`([?&])([A-Za-z0-9_.-]+)=([^&\s"'<>]*)`)
+)
+
+// Redactor 隐藏日志中的 Cookie、Token、预签名地址的签名和配置的 JSON 字段
+type Redactor struct {
+	enabled bool
+	fields  map[string]bool
+}
+
+// global 全局实例，Init 之前使用默认配置，启用隐藏
+var global atomic.Pointer[Redactor]
+
+func init() {
+	global.Store(New(true, nil))
+}
+
+// New 创建 Redactor，enabled 为 false 时原样返回所有内容，fields 追加到默认的 JSON 字段
+func New(enabled bool, fields []string) *Redactor {
+	r := &Redactor{
+		enabled: enabled,
+		fields:  make(map[string]bool, len(defaultFields)+len(fields)),
+	}
+	for _, field := range append(defaultFields, fields...) {
+		if field = strings.ToLower(strings.TrimSpace(field)); field != "" {
+			r.fields[field] = true
+		}
+	}
+	return r
+}
+
+// Init 按日志配置设置全局实例，对应 mask_sensitive 和 redact_fields
+func Init(cfg config.LoggingConfig) {
+	global.Store(New(cfg.MaskSensitive, cfg.RedactFields))
+}
+
+// Headers 使用全局实例隐藏请求头
+func Headers(h http.Header) map[string]string { return global.Load().Headers(h) }
+
+// Header 使用全局实例隐藏单个请求头的值
+func Header(name, value string) string { return global.Load().Header(name, value) }
+
+// URL 使用全局实例隐藏 URL 中的签名和凭证参数
+func URL(raw string) string { return global.Load().URL(raw) }
+
+// Body 使用全局实例隐藏请求体或响应体
+func Body(body []byte) string { return global.Load().Body(body) }
+
+// Secret 使用全局实例隐藏单个敏感值
+func Secret(s string) string { return global.Load().Secret(s) }
+
+// Text 使用全局实例隐藏任意文本中的 Bearer Token 和 URL 签名
+func Text(s string) string { return global.Load().Text(s) }
+
+// Error 返回隐藏了敏感内容的错误日志字段，用于替代 zap.Error
+// 网络错误的信息中包含完整的请求地址，上游错误中包含响应体
+func Error(err error) zap.Field {
+	if err == nil {
+		return zap.Skip()
+	}
+	return zap.String("error", Text(err.Error()))
+}
+
+// Headers 将请求头转换为便于记录的 map，每个请求头只取第一个值
+func (r *Redactor) Headers(h http.Header) map[string]string {
+	headers := make(map[string]string, len(h))
+	for k, v := range h {
+		if len(v) > 0 {
+			headers[k] = r.Header(k, v[0])
+		}
+	}
+	return headers
+}
+
+// Header 隐藏敏感请求头的值，Authorization 保留认证方案和末尾4位便于排查
+func (r *Redactor) Header(name, value string) string {
+	if !r.enabled || value == "" || !sensitiveHeaders[strings.ToLower(name)] {
+		return value
+	}
+	if scheme, token, ok := strings.Cut(value, " "); ok && strings.Contains(strings.ToLower(name), "authorization") {
+		return scheme + " " + maskSecret(token)
+	}
+	return Mask
+}
+
+// Secret 隐藏 Token 等单个敏感值，保留末尾4位便于排查
+func (r *Redactor) Secret(s string) string {
+	if !r.enabled || s == "" {
+		return s
+	}
+	return maskSecret(s)
+}
+
+// URL 隐藏 URL 中的敏感参数，保持其余参数的顺序和编码不变
+func (r *Redactor) URL(raw string) string {
+	if !r.enabled || !strings.Contains(raw, "?") {
+		return raw
+	}
+	return r.Text(raw)
+}
+
+// Body 隐藏请求体或响应体，JSON 按字段名隐藏并处理所有字符串值，其他内容按文本处理
+func (r *Redactor) Body(body []byte) string {
+	if !r.enabled {
+		return string(body)
+	}
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return r.Text(string(body))
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return r.Text(string(body))
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(r.walk(value)); err != nil {
+		return r.Text(string(body))
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// walk 递归处理 JSON 值
+func (r *Redactor) walk(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if r.fields[strings.ToLower(key)] {
+				v[key] = Mask
+				continue
+			}
+			v[key] = r.walk(item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = r.walk(item)
+		}
+		return v
+	case string:
+		return r.Text(v)
+	default:
+		return v
+	}
+}
+
+// Text 隐藏文本中的 Bearer Token 和 URL 中的敏感参数
+func (r *Redactor) Text(s string) string {
+	if !r.enabled {
+		return s
+	}
+	s = bearerPattern.ReplaceAllString(s, "${1}"+Mask)
+	return queryParamPattern.ReplaceAllStringFunc(s, func(param string) string {
+		match := queryParamPattern.FindStringSubmatch(param)
+		if !sensitiveQueryParams[strings.ToLower(match[2])] {
+			return param
+		}
+		return match[1] + match[2] + "=" + Mask
+	})
+}
+
+// maskSecret 只保留末尾4位，较短的值全部隐藏
+func maskSecret(secret string) string {
+	if len(secret) <= 8 {
+		return Mask
+	}
+	return Mask + secret[len(secret)-4:]
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/inflight"
+	"monica-proxy/internal/logger"
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/redact"
+	"monica-proxy/internal/types"
+
+	"go.uber.org/zap"
+)
+
+// adminLogLevels 管理接口允许设置的日志级别
+var adminLogLevels = map[string]bool{
+	"debug": true,
+	"info":  true,
+	"warn":  true,
+	"error": true,
+}
+
+// AdminService 管理接口服务
+type AdminService interface {
+	// Config 获取当前生效的配置，Cookie 和 Token 已隐藏
+	Config() *config.Config
+	// Account 获取 Monica 账号状态
+	Account() *types.AdminAccount
+	// SetAccountDisabled 禁用或启用 Monica 账号，重启后恢复为启用
+	SetAccountDisabled(disabled bool) *types.AdminAccount
+	// Requests 获取正在处理的请求
+	Requests() []inflight.Info
+	// CancelRequest 取消正在处理的请求
+	CancelRequest(id string) error
+	// CacheStats 获取缓存统计
+	CacheStats() *types.AdminCacheStats
+	// LogLevel 获取当前的日志级别
+	LogLevel() string
+	// SetLogLevel 修改日志级别，重启后恢复为配置的级别
+	SetLogLevel(level string) error
+}
+
+// adminService 管理接口服务实现
+type adminService struct {
+	config         *config.Config
+	healthService  HealthService
+	requestService RequestService
+}
+
+// NewAdminService 创建管理接口服务实例
+func NewAdminService(cfg *config.Config, healthService HealthService, requestService RequestService) AdminService {
+	return &adminService{
+		config:         cfg,
+		healthService:  healthService,
+		requestService: requestService,
+	}
+}
+
+// Config 复制配置并隐藏敏感字段，日志级别使用运行时修改后的值
+func (s *adminService) Config() *config.Config {
+	cfg := *s.config
+	cfg.Monica.Cookie = maskConfigValue(cfg.Monica.Cookie)
+	cfg.Security.BearerToken = maskConfigValue(cfg.Security.BearerToken)
+	cfg.Admin.Token = maskConfigValue(cfg.Admin.Token)
+	if len(cfg.Audit.ExcludeKeys) > 0 {
+		keys := make([]string, len(cfg.Audit.ExcludeKeys))
+		for i, key := range cfg.Audit.ExcludeKeys {
+			keys[i] = maskConfigValue(key)
+		}
+		cfg.Audit.ExcludeKeys = keys
+	}
+	cfg.Logging.Level = logger.Level()
+	return &cfg
+}
+
+// Account 获取账号状态，健康状况与 /readyz 的 monica_account 检查一致
+func (s *adminService) Account() *types.AdminAccount {
+	return &types.AdminAccount{
+		ID:            types.AccountKey(s.config.Monica.Cookie),
+		BaseURL:       s.config.Monica.BaseURL,
+		CustomBotMode: s.config.Monica.EnableCustomBotMode,
+		BotUID:        s.config.Monica.BotUID,
+		Disabled:      monica.AccountDisabled(),
+		Health:        s.healthService.Readiness().Checks["monica_account"],
+	}
+}
+
+// SetAccountDisabled 禁用或启用账号，禁用期间 /readyz 失败，新的请求返回服务繁忙
+func (s *adminService) SetAccountDisabled(disabled bool) *types.AdminAccount {
+	monica.SetAccountDisabled(disabled)
+	logger.Warn("管理接口修改账号状态",
+		zap.String("account", types.AccountKey(s.config.Monica.Cookie)),
+		zap.Bool("disabled", disabled),
+	)
+	return s.Account()
+}
+
+// Requests 获取正在处理的请求
+func (s *adminService) Requests() []inflight.Info {
+	return s.requestService.ListRequests()
+}
+
+// CancelRequest 取消请求的 context，上游请求随之中断
+func (s *adminService) CancelRequest(id string) error {
+	return s.requestService.CancelRequest(id, "admin")
+}
+
+// CacheStats 获取上传缓存的统计
+func (s *adminService) CacheStats() *types.AdminCacheStats {
+	return &types.AdminCacheStats{Upload: types.GetUploadCacheStats()}
+}
+
+// LogLevel 获取当前的日志级别
+func (s *adminService) LogLevel() string {
+	return logger.Level()
+}
+
+// SetLogLevel 修改日志级别
+func (s *adminService) SetLogLevel(level string) error {
+	if !adminLogLevels[level] {
+		return errors.NewInvalidInputError("level 必须是 debug、info、warn 或 error", nil)
+	}
+	previous := logger.Level()
+	logger.SetLevel(level)
+	logger.Info("管理接口修改日志级别", zap.String("from", previous), zap.String("to", level))
+	return nil
+}
+
+// maskConfigValue 隐藏配置中的敏感值，不受日志脱敏开关影响
+func maskConfigValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redact.Mask
+}
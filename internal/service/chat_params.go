@@ -0,0 +1,25 @@
+package service
+
+import (
+	"fmt"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/types"
+)
+
+// maxStopSequences stop 参数最多允许的停止序列数，与 OpenAI 保持一致
+const maxStopSequences = 4
+
+// validateChatParams 校验 n、stop 和 max_tokens 参数，返回需要生成的 choice 数量
+func validateChatParams(req *types.ChatCompletionRequest, maxChoices int) (int, error) {
+	n := max(req.N, 1)
+	if n > maxChoices {
+		return 0, errors.NewInvalidInputError(fmt.Sprintf("n 不能超过 %d", maxChoices), nil)
+	}
+	if len(req.Stop) > maxStopSequences {
+		return 0, errors.NewInvalidInputError(fmt.Sprintf("stop 最多包含 %d 个停止序列", maxStopSequences), nil)
+	}
+	if req.MaxTokens < 0 || req.MaxCompletionTokens < 0 {
+		return 0, errors.NewInvalidInputError("max_tokens 不能小于 0", nil)
+	}
+	return n, nil
+}
@@ -2,40 +2,48 @@ package service
 
 import (
 	"context"
+	"io"
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/errors"
 	"monica-proxy/internal/logger"
 	"monica-proxy/internal/monica"
 	"monica-proxy/internal/types"
 
-	"github.com/sashabaranov/go-openai"
 	"go.uber.org/zap"
 )
 
 // ChatService 聊天服务接口
 type ChatService interface {
 	// HandleChatCompletion 处理聊天完成请求
-	HandleChatCompletion(ctx context.Context, req *openai.ChatCompletionRequest) (interface{}, error)
+	HandleChatCompletion(ctx context.Context, req *types.ChatCompletionRequest) (interface{}, error)
 }
 
 // chatService 聊天服务实现
 type chatService struct {
-	config *config.Config
+	config         *config.Config
+	fileService    FileService
+	contextManager *contextManager
 }
 
 // NewChatService 创建聊天服务实例
-func NewChatService(cfg *config.Config) ChatService {
+func NewChatService(cfg *config.Config, fileService FileService) ChatService {
 	return &chatService{
-		config: cfg,
+		config:         cfg,
+		fileService:    fileService,
+		contextManager: newContextManager(cfg),
 	}
 }
 
 // HandleChatCompletion 处理聊天完成请求
-func (s *chatService) HandleChatCompletion(ctx context.Context, req *openai.ChatCompletionRequest) (interface{}, error) {
+func (s *chatService) HandleChatCompletion(ctx context.Context, req *types.ChatCompletionRequest) (interface{}, error) {
 	// 验证请求
 	if len(req.Messages) == 0 {
 		return nil, errors.NewEmptyMessageError()
 	}
+	// 账号被禁用时不再发往 Monica
+	if err := monica.CheckAccount(); err != nil {
+		return nil, err
+	}
 
 	// 日志记录请求
 	// logger.Info("处理聊天请求",
@@ -44,48 +52,52 @@ func (s *chatService) HandleChatCompletion(ctx context.Context, req *openai.Chat
 	// 	zap.Bool("stream", req.Stream),
 	// )
 
-	// 转换请求格式
-	monicaReq, err := types.ChatGPTToMonica(s.config, *req)
+	// 解析消息中引用的已上传文件
+	if err := s.fileService.ResolveMessageFiles(req); err != nil {
+		return nil, err
+	}
+
+	// 超出模型上下文窗口时按策略处理历史消息
+	if err := s.contextManager.fit(ctx, req); err != nil {
+		return nil, err
+	}
+
+	// 每个 choice 对应一个独立的 Monica 会话
+	n, err := validateChatParams(req, s.config.Monica.MaxChoices)
+	if err != nil {
+		return nil, err
+	}
+
+	// 转换请求格式，附件只上传一次，其余 choice 复制消息链作为独立的会话
+	monicaReq, err := types.ChatGPTToMonica(ctx, s.config, *req)
 	if err != nil {
 		logger.Error("转换请求失败", zap.Error(err))
+		if appErr, ok := err.(*errors.AppError); ok {
+			return nil, appErr
+		}
 		return nil, errors.NewInternalError(err)
 	}
+	monicaReqs := []*types.MonicaRequest{monicaReq}
+	for len(monicaReqs) < n {
+		monicaReqs = append(monicaReqs, monicaReq.Clone())
+	}
 
 	// Логируем отправляемый запрос к Monica
 	logger.Info("Отправка запроса к Monica API (обычный чат)",
 		zap.String("model", req.Model),
-		zap.String("language", monicaReq.Language),
-		zap.String("task_type", monicaReq.TaskType),
-		zap.String("bot_uid", monicaReq.BotUID),
+		zap.String("language", monicaReqs[0].Language),
+		zap.String("task_type", monicaReqs[0].TaskType),
+		zap.String("bot_uid", monicaReqs[0].BotUID),
 		zap.Int("message_count", len(req.Messages)),
+		zap.Int("n", n),
 	)
 
 	// 调用Monica API
-	stream, err := monica.SendMonicaRequest(ctx, s.config, monicaReq)
-	if err != nil {
-		logger.Error("调用Monica API失败", zap.Error(err))
-		// 如果已经是AppError，直接返回，否则包装为内部错误
-		if appErr, ok := err.(*errors.AppError); ok {
-			return nil, appErr
+	return completeChoices(ctx, req, n, func(ctx context.Context, i int) (io.ReadCloser, error) {
+		stream, err := monica.SendMonicaRequest(ctx, s.config, monicaReqs[i])
+		if err != nil {
+			return nil, err
 		}
-		return nil, errors.NewInternalError(err)
-	}
-	// 根据是否使用流式响应处理结果
-	if req.Stream {
-		// 这里只返回stream，实际的流处理在handler层
-		// 流式响应时不关闭响应体，让handler层负责关闭
 		return stream.RawBody(), nil
-	}
-
-	// 非流式响应，确保在此函数结束时关闭响应体
-	defer stream.RawBody().Close()
-
-	// 处理非流式响应
-	response, err := monica.CollectMonicaSSEToCompletion(req.Model, stream.RawBody())
-	if err != nil {
-		logger.Error("处理Monica响应失败", zap.Error(err))
-		return nil, errors.NewInternalError(err)
-	}
-
-	return response, nil
+	})
 }
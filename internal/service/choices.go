@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"io"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/logger"
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/types"
+
+	lop "github.com/samber/lo/parallel"
+	"go.uber.org/zap"
+)
+
+// sendFunc 发送第 i 个 choice 对应的 Monica 请求，返回 SSE 响应体
+type sendFunc func(ctx context.Context, i int) (io.ReadCloser, error)
+
+// completeChoices 发送 n 个 choice 的请求并按是否流式处理结果
+// 流式时返回响应体（n>1 时为 monica.ChoiceStreams），由 handler 层负责关闭；非流式时汇总为 chat.completion
+func completeChoices(ctx context.Context, req *types.ChatCompletionRequest, n int, send sendFunc) (interface{}, error) {
+	streams, err := sendChoices(ctx, n, send)
+	if err != nil {
+		logger.Error("调用Monica API失败", zap.Error(err))
+		// 如果已经是AppError，直接返回，否则包装为内部错误
+		if appErr, ok := err.(*errors.AppError); ok {
+			return nil, appErr
+		}
+		return nil, errors.NewInternalError(err)
+	}
+
+	// 根据是否使用流式响应处理结果
+	if req.Stream {
+		// 流式响应时不关闭响应体，让handler层负责关闭
+		if n == 1 {
+			return streams[0], nil
+		}
+		return streams, nil
+	}
+
+	// 非流式响应，确保在此函数结束时关闭响应体
+	defer streams.Close()
+
+	response, err := monica.CollectChoicesToCompletion(ctx, req.Model, monica.NewOutputLimits(req), streams)
+	if err != nil {
+		logger.Error("处理Monica响应失败", zap.Error(err))
+		return nil, errors.NewInternalError(err)
+	}
+	return response, nil
+}
+
+// sendChoices 并行发送 n 个 Monica 请求，每个请求对应一个 choice
+// 任一请求失败时关闭已经成功的响应流并返回错误
+func sendChoices(ctx context.Context, n int, send sendFunc) (monica.ChoiceStreams, error) {
+	type sendResult struct {
+		body io.ReadCloser
+		err  error
+	}
+	results := lop.Times(n, func(i int) sendResult {
+		body, err := send(ctx, i)
+		return sendResult{body: body, err: err}
+	})
+
+	streams := make(monica.ChoiceStreams, 0, n)
+	var firstErr error
+	for _, result := range results {
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			continue
+		}
+		streams = append(streams, result.body)
+	}
+	if firstErr != nil {
+		streams.Close()
+		return nil, firstErr
+	}
+	return streams, nil
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// completeText 使用指定模型进行一次非流式的单轮对话，返回回复的文本
+// 用于提示词优化、历史消息总结等内部辅助任务
+func completeText(ctx context.Context, cfg *config.Config, model, prompt string) (string, error) {
+	chatReq := types.ChatCompletionRequest{
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model: model,
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: prompt},
+			},
+		},
+	}
+	monicaReq, err := types.ChatGPTToMonica(ctx, cfg, chatReq)
+	if err != nil {
+		return "", err
+	}
+
+	stream, err := monica.SendMonicaRequest(ctx, cfg, monicaReq)
+	if err != nil {
+		return "", err
+	}
+	defer stream.RawBody().Close()
+
+	completion, err := monica.CollectMonicaSSEToCompletion(ctx, model, monica.OutputLimits{}, stream.RawBody())
+	if err != nil {
+		return "", err
+	}
+	if len(completion.Choices) == 0 {
+		return "", fmt.Errorf("empty completion")
+	}
+	// 请求被取消时只有部分回复，不能作为结果使用
+	if completion.Choices[0].FinishReason == monica.FinishReasonCancelled {
+		return "", context.Cause(ctx)
+	}
+	return completion.Choices[0].Message.Content, nil
+}
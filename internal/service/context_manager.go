@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/logger"
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/utils"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// 估算 Item 链长度时使用的固定值，Monica 不返回 token 用量，只能粗略估算
+const (
+	itemOverheadTokens   = 4    // 每个 Item 的固定开销
+	imageTokens          = 765  // 单张图片（high/auto detail）
+	lowDetailImageTokens = 85   // 单张 low detail 图片
+	fileTokens           = 2000 // 单个文件，内容由 Monica 解析，无法预先得知
+)
+
+// summarizeTimeout 总结历史消息的超时时间，超时后改为丢弃最早的消息
+const summarizeTimeout = 60 * time.Second
+
+// summarizeInstruction 总结历史消息的指令
+const summarizeInstruction = `Summarize the earlier part of the conversation below so it can replace the original messages as context for continuing the conversation.
+Keep facts, decisions, names, numbers, code identifiers and open questions; drop greetings and repetition. Write in the language of the conversation and reply with the summary only.
+
+`
+
+// summaryPrefix 摘要作为用户消息插入时的前缀
+const summaryPrefix = "Summary of the earlier conversation:\n"
+
+// summaryAck 摘要之后虚拟的助手回复，与摘要组成一组问答，不受 system prompt 策略影响
+const summaryAck = "OK. I will continue the conversation with this context."
+
+// modelFamilyWindows 各模型系列的上下文窗口大小（token），按模型名前缀匹配，靠前的优先
+var modelFamilyWindows = []struct {
+	prefix string
+	window int
+}{
+	{"gpt-5", 400000},
+	{"gpt-4.1", 1047576},
+	{"gpt-4", 128000},
+	{"o1", 128000},
+	{"o3", 200000},
+	{"o4", 200000},
+	{"claude", 200000},
+	{"gemini", 1048576},
+	{"deepseek", 64000},
+	{"deepclaude", 64000},
+	{"sonar", 128000},
+	{"grok-3", 131072},
+	{"grok-4", 256000},
+}
+
+// modelContextWindows 支持的模型的上下文窗口大小，由模型列表和系列窗口生成，可通过配置覆盖
+var modelContextWindows = buildModelContextWindows(types.GetSupportedModels())
+
+// buildModelContextWindows 按模型系列生成上下文窗口表，没有匹配系列的模型使用配置的默认值
+func buildModelContextWindows(models []string) map[string]int {
+	windows := make(map[string]int, len(models))
+	for _, model := range models {
+		for _, family := range modelFamilyWindows {
+			if strings.HasPrefix(model, family.prefix) {
+				windows[model] = family.window
+				break
+			}
+		}
+	}
+	return windows
+}
+
+// contextManager 在转换为 Monica 请求前估算 Item 链的长度
+// 超出模型上下文窗口时按配置的策略裁剪或总结历史消息
+type contextManager struct {
+	config *config.Config
+}
+
+// newContextManager 创建上下文管理器
+func newContextManager(cfg *config.Config) *contextManager {
+	return &contextManager{config: cfg}
+}
+
+// fit 使请求的消息适应模型的上下文窗口，会直接修改 req.Messages 和 req.Files
+// system 消息和最后一条消息始终保留，仍然超出时返回 context_length_exceeded 错误
+func (m *contextManager) fit(ctx context.Context, req *types.ChatCompletionRequest) error {
+	cfg := m.config.Context
+	if cfg.Policy == config.ContextPolicyNone {
+		return nil
+	}
+
+	window := m.contextWindow(req.Model)
+	reserve := max(cfg.ReserveTokens, req.MaxTokens, req.MaxCompletionTokens)
+	budget := window - reserve
+
+	tokens := make([]int, len(req.Messages))
+	total := itemOverheadTokens // 欢迎消息头
+	var system, conversation []int
+	for i, msg := range req.Messages {
+		tokens[i] = estimateMessageTokens(msg)
+		total += tokens[i]
+		if msg.Role == openai.ChatMessageRoleSystem {
+			system = append(system, i)
+		} else {
+			conversation = append(conversation, i)
+		}
+	}
+	if total <= budget {
+		return nil
+	}
+	if cfg.Policy == config.ContextPolicyReject || len(conversation) == 0 {
+		return errors.NewContextLengthExceededError(total+reserve, window)
+	}
+
+	fixed := itemOverheadTokens
+	for _, i := range system {
+		fixed += tokens[i]
+	}
+
+	// 按策略确定要保留的消息，summary 不为空时作为一组问答插入
+	kept := conversation
+	var summary string
+	switch cfg.Policy {
+	case config.ContextPolicyKeepLast:
+		if len(kept) > cfg.KeepLast {
+			kept = kept[len(kept)-cfg.KeepLast:]
+		}
+	case config.ContextPolicySummarize:
+		summary, kept = m.summarize(ctx, req, tokens, kept, budget-fixed)
+		if summary != "" {
+			fixed += 2*itemOverheadTokens + utils.EstimateTokens(summaryPrefix+summary) + utils.EstimateTokens(summaryAck)
+		}
+	}
+
+	// 仍然超出时从最早的消息开始丢弃，保证第一条是用户消息
+	used := fixed
+	for _, i := range kept {
+		used += tokens[i]
+	}
+	for len(kept) > 1 && (used > budget || req.Messages[kept[0]].Role != openai.ChatMessageRoleUser) {
+		used -= tokens[kept[0]]
+		kept = kept[1:]
+	}
+	if used > budget {
+		return errors.NewContextLengthExceededError(used+reserve, window)
+	}
+
+	logger.Info("对话超出上下文窗口，已裁剪历史消息",
+		zap.String("model", req.Model),
+		zap.String("policy", cfg.Policy),
+		zap.Int("window", window),
+		zap.Int("tokens_before", total),
+		zap.Int("tokens_after", used),
+		zap.Int("dropped", len(conversation)-len(kept)),
+		zap.Bool("summarized", summary != ""),
+	)
+
+	rebuildMessages(req, system, kept, summary)
+	return nil
+}
+
+// contextWindow 获取模型的上下文窗口大小，配置优先于内置值
+func (m *contextManager) contextWindow(model string) int {
+	if window, ok := m.config.Context.ModelWindows[model]; ok && window > 0 {
+		return window
+	}
+	if window, ok := modelContextWindows[model]; ok {
+		return window
+	}
+	return m.config.Context.DefaultWindow
+}
+
+// summarize 将放不下的较早消息总结为摘要，最近的消息保留原文并占用不超过一半的预算
+// 返回摘要和保留的消息，总结失败时返回空摘要，由调用方继续丢弃最早的消息
+func (m *contextManager) summarize(ctx context.Context, req *types.ChatCompletionRequest, tokens, conversation []int, budget int) (string, []int) {
+	split := len(conversation) - 1
+	used := tokens[conversation[split]]
+	for split > 0 && used+tokens[conversation[split-1]] <= budget/2 {
+		split--
+		used += tokens[conversation[split]]
+	}
+	// 保留部分从用户消息开始，避免之后被当作不完整的轮次丢弃
+	for split < len(conversation)-1 && req.Messages[conversation[split]].Role != openai.ChatMessageRoleUser {
+		split++
+	}
+	if split == 0 {
+		return "", conversation
+	}
+
+	// 转写较早的消息，超出总结模型的窗口时只保留靠后的部分
+	limit := m.contextWindow(m.config.Context.SummaryModel) - m.config.Context.ReserveTokens - utils.EstimateTokens(summarizeInstruction)
+	var lines []string
+	transcriptTokens := 0
+	for j := split - 1; j >= 0; j-- {
+		line := transcribeMessage(req.Messages[conversation[j]])
+		lineTokens := utils.EstimateTokens(line)
+		if transcriptTokens+lineTokens > limit {
+			break
+		}
+		transcriptTokens += lineTokens
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return "", conversation
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, summarizeTimeout)
+	defer cancel()
+
+	summary, err := completeText(ctx, m.config, m.config.Context.SummaryModel, summarizeInstruction+strings.Join(lines, "\n\n"))
+	summary = strings.TrimSpace(summary)
+	if err != nil || summary == "" {
+		logger.Warn("总结历史消息失败，改为丢弃最早的消息",
+			zap.String("summary_model", m.config.Context.SummaryModel),
+			zap.Error(err),
+		)
+		return "", conversation
+	}
+	return summary, conversation[split:]
+}
+
+// rebuildMessages 按保留的消息下标重建消息列表，并同步调整按消息下标索引的文件数据
+func rebuildMessages(req *types.ChatCompletionRequest, system, kept []int, summary string) {
+	keep := make(map[int]bool, len(system)+len(kept))
+	for _, i := range system {
+		keep[i] = true
+	}
+	for _, i := range kept {
+		keep[i] = true
+	}
+
+	messages := make([]openai.ChatCompletionMessage, 0, len(keep)+2)
+	var files types.MessageFiles
+	for i, msg := range req.Messages {
+		if !keep[i] {
+			continue
+		}
+		// 摘要作为一组问答放在第一条保留的对话消息之前，system 策略为 none 时也会发送
+		if summary != "" && i == kept[0] {
+			messages = append(messages,
+				openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: summaryPrefix + summary},
+				openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: summaryAck},
+			)
+		}
+		if parts, ok := req.Files[i]; ok {
+			if files == nil {
+				files = make(types.MessageFiles)
+			}
+			files[len(messages)] = parts
+		}
+		messages = append(messages, msg)
+	}
+	req.Messages = messages
+	req.Files = files
+}
+
+// estimateMessageTokens 估算单条消息转换为 Monica Item 后的 token 数
+func estimateMessageTokens(msg openai.ChatCompletionMessage) int {
+	tokens := itemOverheadTokens + utils.EstimateTokens(msg.Content)
+	for _, part := range msg.MultiContent {
+		switch part.Type {
+		case openai.ChatMessagePartTypeText:
+			tokens += utils.EstimateTokens(part.Text)
+		case openai.ChatMessagePartTypeImageURL:
+			if part.ImageURL != nil && part.ImageURL.Detail == openai.ImageURLDetailLow {
+				tokens += lowDetailImageTokens
+			} else {
+				tokens += imageTokens
+			}
+		case types.ChatMessagePartTypeFile:
+			tokens += fileTokens
+		}
+	}
+	return tokens
+}
+
+// transcribeMessage 将消息转写为用于总结的文本，附件用占位符表示
+func transcribeMessage(msg openai.ChatCompletionMessage) string {
+	var sb strings.Builder
+	sb.WriteString(msg.Role)
+	sb.WriteString(": ")
+	sb.WriteString(msg.Content)
+	for _, part := range msg.MultiContent {
+		switch part.Type {
+		case openai.ChatMessagePartTypeText:
+			sb.WriteString(part.Text)
+		case openai.ChatMessagePartTypeImageURL:
+			sb.WriteString("[image]")
+		case types.ChatMessagePartTypeFile:
+			sb.WriteString("[file]")
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/mock"
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/utils"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestContextManagerFit(t *testing.T) {
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+	srv.Config.Handler = mock.NewServer(srv.URL, mock.Options{}).Handler()
+
+	body := strings.Repeat("lorem ipsum dolor sit amet ", 40)
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "You are helpful."},
+		{Role: openai.ChatMessageRoleUser, Content: "[mock:reply=We discussed lorem ipsum.] u1 " + body},
+		{Role: openai.ChatMessageRoleAssistant, Content: "a1 " + body},
+		{Role: openai.ChatMessageRoleUser, Content: "u2 " + body},
+		{Role: openai.ChatMessageRoleAssistant, Content: "a2 " + body},
+		{Role: openai.ChatMessageRoleUser, Content: "u3 " + body},
+	}
+	// 窗口能容纳 system 消息和三条半对话消息
+	perMessage := estimateMessageTokens(messages[5])
+	window := itemOverheadTokens + estimateMessageTokens(messages[0]) + perMessage*7/2
+
+	firstFile := map[int]*types.ChatMessageFile{0: {FileID: "file-1"}}
+	lastFile := map[int]*types.ChatMessageFile{0: {FileID: "file-5"}}
+
+	tests := []struct {
+		name      string
+		policy    string
+		keepLast  int
+		want      []string // 保留的消息内容前缀
+		wantFiles types.MessageFiles
+		wantErr   bool
+	}{
+		{
+			name:      "drop_oldest",
+			policy:    config.ContextPolicyDropOldest,
+			want:      []string{"You are helpful.", "u2", "a2", "u3"},
+			wantFiles: types.MessageFiles{3: lastFile},
+		},
+		{
+			name:      "keep_last starts with user message",
+			policy:    config.ContextPolicyKeepLast,
+			keepLast:  2,
+			want:      []string{"You are helpful.", "u3"},
+			wantFiles: types.MessageFiles{1: lastFile},
+		},
+		{
+			name:      "summarize",
+			policy:    config.ContextPolicySummarize,
+			want:      []string{"You are helpful.", summaryPrefix + "We discussed lorem ipsum.", summaryAck, "u3"},
+			wantFiles: types.MessageFiles{3: lastFile},
+		},
+		{
+			name:    "reject",
+			policy:  config.ContextPolicyReject,
+			wantErr: true,
+		},
+		{
+			name:      "none",
+			policy:    config.ContextPolicyNone,
+			want:      []string{"You are helpful.", "[mock:reply", "a1", "u2", "a2", "u3"},
+			wantFiles: types.MessageFiles{1: firstFile, 5: lastFile},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Monica.BaseURL = srv.URL
+			cfg.Context = config.ContextConfig{
+				Policy:        tt.policy,
+				KeepLast:      tt.keepLast,
+				SummaryModel:  "gpt-4o-mini",
+				ModelWindows:  map[string]int{"test-model": window},
+				DefaultWindow: 128000,
+			}
+			types.InitMonicaURLs(cfg)
+			utils.InitHTTPClients(cfg)
+
+			req := &types.ChatCompletionRequest{
+				ChatCompletionRequest: openai.ChatCompletionRequest{
+					Model:    "test-model",
+					Messages: append([]openai.ChatCompletionMessage(nil), messages...),
+				},
+				Files: types.MessageFiles{1: firstFile, 5: lastFile},
+			}
+
+			err := newContextManager(cfg).fit(context.Background(), req)
+			if tt.wantErr {
+				var appErr *errors.AppError
+				if !stderrors.As(err, &appErr) {
+					t.Fatalf("fit() error = %v, want AppError", err)
+				}
+				if appErr.OpenAICode != "context_length_exceeded" || appErr.Status != http.StatusBadRequest || appErr.Param != "messages" {
+					t.Errorf("error = %+v, want context_length_exceeded on messages", appErr)
+				}
+				if len(req.Messages) != len(messages) {
+					t.Errorf("rejected request was modified: %d messages", len(req.Messages))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fit() error = %v", err)
+			}
+
+			var got []string
+			for _, msg := range req.Messages {
+				got = append(got, msg.Content)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d messages, want %d: %q", len(got), len(tt.want), got)
+			}
+			for i, prefix := range tt.want {
+				if !strings.HasPrefix(got[i], prefix) {
+					t.Errorf("messages[%d] = %.40q, want prefix %q", i, got[i], prefix)
+				}
+			}
+			if !reflect.DeepEqual(req.Files, tt.wantFiles) {
+				t.Errorf("Files = %v, want %v", req.Files, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestModelContextWindows(t *testing.T) {
+	for _, model := range types.GetSupportedModels() {
+		if _, ok := modelContextWindows[model]; !ok {
+			t.Errorf("supported model %s has no context window", model)
+		}
+	}
+	if got := modelContextWindows["gpt-4.1-mini"]; got != 1047576 {
+		t.Errorf("gpt-4.1-mini window = %d, want 1047576", got)
+	}
+	if got := modelContextWindows["gpt-4o"]; got != 128000 {
+		t.Errorf("gpt-4o window = %d, want 128000", got)
+	}
+}
@@ -2,38 +2,46 @@ package service
 
 import (
 	"context"
+	"io"
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/errors"
 	"monica-proxy/internal/logger"
 	"monica-proxy/internal/monica"
 	"monica-proxy/internal/types"
 
-	"github.com/sashabaranov/go-openai"
 	"go.uber.org/zap"
 )
 
 // CustomBotService 定义自定义Bot服务接口
 type CustomBotService interface {
-	HandleCustomBotChat(ctx context.Context, req *openai.ChatCompletionRequest, botUID string) (interface{}, error)
+	HandleCustomBotChat(ctx context.Context, req *types.ChatCompletionRequest, botUID string) (interface{}, error)
 }
 
 type customBotService struct {
-	config *config.Config
+	config         *config.Config
+	fileService    FileService
+	contextManager *contextManager
 }
 
 // NewCustomBotService 创建自定义Bot服务实例
-func NewCustomBotService(cfg *config.Config) CustomBotService {
+func NewCustomBotService(cfg *config.Config, fileService FileService) CustomBotService {
 	return &customBotService{
-		config: cfg,
+		config:         cfg,
+		fileService:    fileService,
+		contextManager: newContextManager(cfg),
 	}
 }
 
 // HandleCustomBotChat 处理自定义Bot对话请求
-func (s *customBotService) HandleCustomBotChat(ctx context.Context, req *openai.ChatCompletionRequest, botUID string) (interface{}, error) {
+func (s *customBotService) HandleCustomBotChat(ctx context.Context, req *types.ChatCompletionRequest, botUID string) (interface{}, error) {
 	// 验证请求
 	if len(req.Messages) == 0 {
 		return nil, errors.NewEmptyMessageError()
 	}
+	// 账号被禁用时不再发往 Monica
+	if err := monica.CheckAccount(); err != nil {
+		return nil, err
+	}
 
 	// 日志记录请求
 	logger.Info("处理Custom Bot聊天请求",
@@ -43,49 +51,53 @@ func (s *customBotService) HandleCustomBotChat(ctx context.Context, req *openai.
 		zap.Bool("stream", req.Stream),
 	)
 
-	// 转换请求格式
-	customBotReq, err := types.ChatGPTToCustomBot(s.config, *req, botUID)
+	// 解析消息中引用的已上传文件
+	if err := s.fileService.ResolveMessageFiles(req); err != nil {
+		return nil, err
+	}
+
+	// 超出模型上下文窗口时按策略处理历史消息
+	if err := s.contextManager.fit(ctx, req); err != nil {
+		return nil, err
+	}
+
+	// 每个 choice 对应一个独立的 Monica 会话
+	n, err := validateChatParams(req, s.config.Monica.MaxChoices)
+	if err != nil {
+		return nil, err
+	}
+
+	// 转换请求格式，附件只上传一次，其余 choice 复制消息链作为独立的会话
+	customBotReq, err := types.ChatGPTToCustomBot(ctx, s.config, *req, botUID)
 	if err != nil {
 		logger.Error("转换Custom Bot请求失败", zap.Error(err))
+		if appErr, ok := err.(*errors.AppError); ok {
+			return nil, appErr
+		}
 		return nil, errors.NewInternalError(err)
 	}
+	customBotReqs := []*types.CustomBotRequest{customBotReq}
+	for len(customBotReqs) < n {
+		customBotReqs = append(customBotReqs, customBotReq.Clone())
+	}
 
 	// Логируем отправляемый запрос к Monica Custom Bot API
 	logger.Info("Отправка запроса к Monica Custom Bot API",
 		zap.String("model", req.Model),
 		zap.String("bot_uid", botUID),
-		zap.String("language", customBotReq.Language),
-		zap.String("locale", customBotReq.Locale),
-		zap.String("ai_resp_language", customBotReq.AIRespLanguage),
+		zap.String("language", customBotReqs[0].Language),
+		zap.String("locale", customBotReqs[0].Locale),
+		zap.String("ai_resp_language", customBotReqs[0].AIRespLanguage),
 		zap.Int("message_count", len(req.Messages)),
+		zap.Int("n", n),
 	)
 
 	// 调用Monica Custom Bot API
-	stream, err := monica.SendCustomBotRequest(ctx, s.config, customBotReq)
-	if err != nil {
-		logger.Error("调用Custom Bot API失败", zap.Error(err))
-		// 如果已经是AppError，直接返回，否则包装为内部错误
-		if appErr, ok := err.(*errors.AppError); ok {
-			return nil, appErr
+	return completeChoices(ctx, req, n, func(ctx context.Context, i int) (io.ReadCloser, error) {
+		stream, err := monica.SendCustomBotRequest(ctx, s.config, customBotReqs[i])
+		if err != nil {
+			return nil, err
 		}
-		return nil, errors.NewInternalError(err)
-	}
-
-	// 根据是否使用流式响应处理结果
-	if req.Stream {
-		// 流式响应时不关闭响应体，让handler层负责关闭
 		return stream.RawBody(), nil
-	}
-
-	// 非流式响应，确保在此函数结束时关闭响应体
-	defer stream.RawBody().Close()
-
-	// 处理非流式响应
-	response, err := monica.CollectMonicaSSEToCompletion(req.Model, stream.RawBody())
-	if err != nil {
-		logger.Error("处理Custom Bot响应失败", zap.Error(err))
-		return nil, errors.NewInternalError(err)
-	}
-
-	return response, nil
+	})
 }
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/logger"
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/storage"
+	"monica-proxy/internal/types"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// 本地文件ID前缀，与 Monica 的 file_uid 区分
+const fileIDPrefix = "file-"
+
+// FileService 文件服务接口
+type FileService interface {
+	// UploadFile 上传文件到Monica并保存记录
+	UploadFile(ctx context.Context, fileName, purpose string, data []byte) (*types.FileObject, error)
+	// ListFiles 列出已上传的文件
+	ListFiles(purpose string) []types.FileObject
+	// GetFile 获取文件信息
+	GetFile(id string) (*types.FileObject, error)
+	// DeleteFile 删除文件记录
+	DeleteFile(id string) error
+	// ResolveMessageFiles 将消息中引用的 file_id 解析为已上传的文件
+	ResolveMessageFiles(req *types.ChatCompletionRequest) error
+}
+
+// fileService 文件服务实现
+type fileService struct {
+	config *config.Config
+	store  *storage.FileStore
+}
+
+// NewFileService 创建文件服务实例
+func NewFileService(cfg *config.Config, store *storage.FileStore) FileService {
+	return &fileService{
+		config: cfg,
+		store:  store,
+	}
+}
+
+// UploadFile 上传文件到Monica并保存记录
+func (s *fileService) UploadFile(ctx context.Context, fileName, purpose string, data []byte) (*types.FileObject, error) {
+	if len(data) == 0 {
+		return nil, errors.NewInvalidInputError("文件内容不能为空", nil)
+	}
+	if len(data) > types.MaxFileSize {
+		return nil, errors.NewInvalidInputError(fmt.Sprintf("文件大小超过限制: %d", types.MaxFileSize), nil)
+	}
+	if err := monica.CheckAccount(); err != nil {
+		return nil, err
+	}
+
+	uploadCtx, cancel := context.WithTimeout(ctx, types.DocumentUploadTimeout)
+	defer cancel()
+
+	fileInfo, err := types.UploadFileData(uploadCtx, s.config, data, "", fileName)
+	if err != nil {
+		logger.Error("上传文件失败", zap.String("file_name", fileName), zap.Error(err))
+		if appErr, ok := err.(*errors.AppError); ok {
+			return nil, appErr
+		}
+		return nil, errors.NewFileUploadError(err)
+	}
+
+	now := time.Now()
+	record := &storage.FileRecord{
+		FileObject: types.FileObject{
+			ID:        fileIDPrefix + strings.ReplaceAll(uuid.New().String(), "-", ""),
+			Object:    "file",
+			Bytes:     int64(len(data)),
+			CreatedAt: now.Unix(),
+			Filename:  fileName,
+			Purpose:   purpose,
+			Status:    "processed",
+			ExpiresAt: s.expiresAt(fileInfo.FileUID, now),
+		},
+		FileInfo: *fileInfo,
+	}
+	if err := s.store.Save(record); err != nil {
+		logger.Error("保存文件记录失败", zap.String("file_id", record.ID), zap.Error(err))
+		return nil, errors.NewInternalError(err)
+	}
+
+	logger.Info("文件上传成功",
+		zap.String("file_id", record.ID),
+		zap.String("file_uid", fileInfo.FileUID),
+		zap.String("file_name", fileName),
+		zap.Int64("file_tokens", fileInfo.FileTokens),
+	)
+
+	obj := record.FileObject
+	return &obj, nil
+}
+
+// expiresAt 计算文件记录的过期时间，与 Monica 文件的有效期（上传缓存的 TTL）保持一致
+// 命中上传缓存时 Monica 文件是之前上传的，使用缓存条目的过期时间
+func (s *fileService) expiresAt(fileUID string, now time.Time) int64 {
+	if expiresAt, ok := types.UploadExpiresAt(fileUID); ok {
+		return expiresAt.Unix()
+	}
+	if s.config.Upload.CacheTTL <= 0 {
+		return 0
+	}
+	return now.Add(s.config.Upload.CacheTTL).Unix()
+}
+
+// ListFiles 列出已上传且未过期的文件
+func (s *fileService) ListFiles(purpose string) []types.FileObject {
+	records := s.store.List(purpose)
+	files := make([]types.FileObject, 0, len(records))
+	now := time.Now()
+	for _, record := range records {
+		if record.Expired(now, s.config.Upload.CacheTTL) {
+			continue
+		}
+		files = append(files, record.FileObject)
+	}
+	return files
+}
+
+// GetFile 获取文件信息
+func (s *fileService) GetFile(id string) (*types.FileObject, error) {
+	record, err := s.getRecord(id)
+	if err != nil {
+		return nil, err
+	}
+	obj := record.FileObject
+	return &obj, nil
+}
+
+// getRecord 获取未过期的文件记录，过期的记录对应的 Monica 文件已不可用，按不存在处理
+func (s *fileService) getRecord(id string) (*storage.FileRecord, error) {
+	record, ok := s.store.Get(id)
+	if !ok {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("文件不存在: %s", id))
+	}
+	if record.Expired(time.Now(), s.config.Upload.CacheTTL) {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("文件已过期，请重新上传: %s", id))
+	}
+	return record, nil
+}
+
+// DeleteFile 删除文件记录，Monica 侧的文件会随时间自动过期
+func (s *fileService) DeleteFile(id string) error {
+	deleted, err := s.store.Delete(id)
+	if err != nil {
+		logger.Error("删除文件记录失败", zap.String("file_id", id), zap.Error(err))
+		return errors.NewInternalError(err)
+	}
+	if !deleted {
+		return errors.NewNotFoundError(fmt.Sprintf("文件不存在: %s", id))
+	}
+	return nil
+}
+
+// ResolveMessageFiles 将消息中引用的本地 file_id 解析为已上传的文件
+// 非本地ID的引用保持不变，后续按 Monica 的 file_uid 处理
+func (s *fileService) ResolveMessageFiles(req *types.ChatCompletionRequest) error {
+	for _, parts := range req.Files {
+		for _, file := range parts {
+			if file == nil || !strings.HasPrefix(file.FileID, fileIDPrefix) {
+				continue
+			}
+			record, err := s.getRecord(file.FileID)
+			if err != nil {
+				return err
+			}
+			fileInfo := record.FileInfo
+			file.Resolved = &fileInfo
+		}
+	}
+	return nil
+}
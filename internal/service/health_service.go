@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/logger"
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/utils"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// HealthService 健康检查服务接口
+type HealthService interface {
+	// Readiness 检查配置、Monica 账号和 HTTP 客户端是否就绪
+	Readiness() *types.ReadinessResponse
+}
+
+// healthService 健康检查服务实现
+type healthService struct {
+	config *config.Config
+
+	// 上游探测结果的缓存，避免频繁的探针请求打到 Monica
+	probeMu      sync.Mutex
+	probeResult  types.HealthCheck
+	probeExpires time.Time
+}
+
+// NewHealthService 创建健康检查服务实例
+func NewHealthService(cfg *config.Config) HealthService {
+	return &healthService{
+		config: cfg,
+	}
+}
+
+// Readiness 检查各项依赖，全部通过时状态为 ok
+func (s *healthService) Readiness() *types.ReadinessResponse {
+	checks := map[string]types.HealthCheck{
+		"config":         s.checkConfig(),
+		"http_clients":   s.checkHTTPClients(),
+		"monica_account": s.checkMonicaAccount(),
+	}
+
+	status := types.HealthStatusOK
+	for _, check := range checks {
+		if check.Status != types.HealthStatusOK {
+			status = types.HealthStatusFail
+			break
+		}
+	}
+	return &types.ReadinessResponse{Status: status, Checks: checks}
+}
+
+// checkConfig 检查配置是否有效
+func (s *healthService) checkConfig() types.HealthCheck {
+	if err := s.config.Validate(); err != nil {
+		return types.HealthCheck{Status: types.HealthStatusFail, Message: err.Error()}
+	}
+	return types.HealthCheck{Status: types.HealthStatusOK}
+}
+
+// checkHTTPClients 检查调用 Monica 的 HTTP 客户端是否已初始化
+func (s *healthService) checkHTTPClients() types.HealthCheck {
+	if utils.RestySSEClient == nil || utils.RestyDefaultClient == nil {
+		return types.HealthCheck{Status: types.HealthStatusFail, Message: "http clients not initialized"}
+	}
+	return types.HealthCheck{Status: types.HealthStatusOK}
+}
+
+// checkMonicaAccount 检查是否配置了 Monica Cookie 以及账号是否被禁用，启用上游探测时使用缓存的探测结果
+func (s *healthService) checkMonicaAccount() types.HealthCheck {
+	if s.config.Monica.Cookie == "" {
+		return types.HealthCheck{Status: types.HealthStatusFail, Message: "monica cookie not configured"}
+	}
+	if monica.AccountDisabled() {
+		return types.HealthCheck{Status: types.HealthStatusFail, Message: "monica account disabled by admin"}
+	}
+	if !s.config.Health.ProbeUpstream {
+		return types.HealthCheck{Status: types.HealthStatusOK}
+	}
+
+	s.probeMu.Lock()
+	defer s.probeMu.Unlock()
+	if time.Now().Before(s.probeExpires) {
+		return s.probeResult
+	}
+
+	s.probeResult = s.probeUpstream()
+	s.probeExpires = time.Now().Add(s.config.Health.ProbeTTL)
+	if s.probeResult.Status != types.HealthStatusOK {
+		logger.Warn("Monica 上游探测失败", zap.String("message", s.probeResult.Message))
+	}
+	return s.probeResult
+}
+
+// probeUpstream 使用账号 Cookie 查询一个空的文件列表，确认 Monica 可以访问且 Cookie 有效
+// 使用独立的超时，不受单个探针请求取消的影响，保证结果可以缓存
+func (s *healthService) probeUpstream() types.HealthCheck {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Health.ProbeTimeout)
+	defer cancel()
+
+	check := types.HealthCheck{Status: types.HealthStatusFail, CheckedAt: time.Now().Unix()}
+	resp, err := utils.RestyDefaultClient.R().
+		SetContext(ctx).
+		SetHeader("cookie", s.config.Monica.Cookie).
+		SetBody(map[string][]string{"file_uids": {}}).
+		Post(types.FileGetURL)
+	switch {
+	case err != nil:
+		check.Message = fmt.Sprintf("monica unreachable: %v", err)
+	case resp.StatusCode() == http.StatusUnauthorized || resp.StatusCode() == http.StatusForbidden:
+		check.Message = fmt.Sprintf("monica rejected the cookie: status %d", resp.StatusCode())
+	case resp.IsError():
+		check.Message = fmt.Sprintf("monica returned status %d", resp.StatusCode())
+	default:
+		check.Status = types.HealthStatusOK
+	}
+	return check
+}
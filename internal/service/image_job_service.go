@@ -0,0 +1,267 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/logger"
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/utils"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// 回调通知相关常量
+const (
+	webhookAttempts  = 3
+	webhookRetryWait = 2 * time.Second
+)
+
+// imageJobCleanupInterval 清理过期任务的间隔
+const imageJobCleanupInterval = 10 * time.Minute
+
+// ImageJobService 异步图片任务服务接口
+type ImageJobService interface {
+	// SubmitImageJob 提交异步图片生成任务，立即返回任务信息
+	SubmitImageJob(req *types.ImageGenerationRequest, baseURL string) (*types.ImageJob, error)
+	// GetImageJob 获取任务状态和结果
+	GetImageJob(id string) (*types.ImageJob, error)
+}
+
+// imageJob 任务及其执行所需的参数
+type imageJob struct {
+	job         types.ImageJob
+	req         *types.ImageGenerationRequest
+	baseURL     string
+	callbackURL string
+}
+
+// imageJobService 异步图片任务服务实现
+// 任务在固定数量的 worker 中执行，使用独立的 context，不受客户端断开连接影响
+type imageJobService struct {
+	config       *config.Config
+	imageService ImageService
+
+	mu    sync.RWMutex
+	jobs  map[string]*imageJob
+	queue chan *imageJob
+}
+
+// NewImageJobService 创建异步图片任务服务实例并启动 worker
+func NewImageJobService(cfg *config.Config, imageService ImageService) ImageJobService {
+	s := &imageJobService{
+		config:       cfg,
+		imageService: imageService,
+		jobs:         make(map[string]*imageJob),
+		queue:        make(chan *imageJob, cfg.Image.JobQueueSize),
+	}
+	for i := 0; i < cfg.Image.JobWorkers; i++ {
+		go s.worker()
+	}
+	go s.cleanupLoop()
+	return s
+}
+
+// SubmitImageJob 提交异步图片生成任务
+func (s *imageJobService) SubmitImageJob(req *types.ImageGenerationRequest, baseURL string) (*types.ImageJob, error) {
+	if req.Prompt == "" {
+		return nil, errors.NewInvalidInputError("提示词不能为空", nil)
+	}
+	if err := validateResponseFormat(req.ResponseFormat); err != nil {
+		return nil, err
+	}
+	if req.N > maxImageCount {
+		return nil, errors.NewInvalidInputError(fmt.Sprintf("n 不能超过 %d", maxImageCount), nil)
+	}
+	if err := monica.CheckAccount(); err != nil {
+		return nil, err
+	}
+	if req.CallbackURL != "" {
+		u, err := url.Parse(req.CallbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, errors.NewInvalidInputError("callback_url 必须是 http(s) 地址", err)
+		}
+	}
+
+	job := &imageJob{
+		job: types.ImageJob{
+			ID:        "imgjob-" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+			Object:    "image.job",
+			Status:    types.ImageJobQueued,
+			CreatedAt: time.Now().Unix(),
+		},
+		req:         req,
+		baseURL:     baseURL,
+		callbackURL: req.CallbackURL,
+	}
+
+	s.mu.Lock()
+	select {
+	case s.queue <- job:
+		s.jobs[job.job.ID] = job
+	default:
+		s.mu.Unlock()
+		return nil, errors.NewServiceBusyError("图片任务队列已满，请稍后重试")
+	}
+	snapshot := job.job
+	s.mu.Unlock()
+
+	logger.Info("提交异步图片任务",
+		zap.String("job_id", snapshot.ID),
+		zap.Int("count", req.N),
+		zap.Bool("callback", job.callbackURL != ""),
+	)
+	return &snapshot, nil
+}
+
+// GetImageJob 获取任务状态和结果
+func (s *imageJobService) GetImageJob(id string) (*types.ImageJob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("任务不存在: %s", id))
+	}
+	snapshot := job.job
+	return &snapshot, nil
+}
+
+// worker 从队列中取出任务并执行
+func (s *imageJobService) worker() {
+	for job := range s.queue {
+		s.run(job)
+	}
+}
+
+// run 执行单个任务，完成后发送回调通知
+func (s *imageJobService) run(job *imageJob) {
+	s.update(job, func(j *types.ImageJob) {
+		j.Status = types.ImageJobRunning
+		j.StartedAt = time.Now().Unix()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Image.JobTimeout)
+	defer cancel()
+	ctx = monica.WithImageProgress(ctx, func(elapsed, expected time.Duration) {
+		progress := 99
+		if expected > 0 && elapsed < expected {
+			progress = int(elapsed * 100 / expected)
+		}
+		s.update(job, func(j *types.ImageJob) {
+			j.Progress = min(max(progress, j.Progress), 99)
+		})
+	})
+
+	resp, err := s.imageService.GenerateImage(ctx, job.req, job.baseURL)
+	s.update(job, func(j *types.ImageJob) {
+		j.CompletedAt = time.Now().Unix()
+		if err != nil {
+			j.Status = types.ImageJobFailed
+			j.Error = &types.ImageJobError{Message: jobErrorMessage(err)}
+			return
+		}
+		j.Status = types.ImageJobSucceeded
+		j.Progress = 100
+		j.Result = resp
+	})
+
+	if err != nil {
+		logger.Error("异步图片任务失败", zap.String("job_id", job.job.ID), zap.Error(err))
+	} else {
+		logger.Info("异步图片任务完成", zap.String("job_id", job.job.ID), zap.Int("count", len(resp.Data)))
+	}
+
+	if job.callbackURL != "" {
+		s.notify(job)
+	}
+}
+
+// update 在锁内修改任务状态
+func (s *imageJobService) update(job *imageJob, fn func(j *types.ImageJob)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&job.job)
+}
+
+// notify 将任务结果 POST 到回调地址，失败时重试
+func (s *imageJobService) notify(job *imageJob) {
+	s.mu.RLock()
+	body, err := json.Marshal(job.job)
+	s.mu.RUnlock()
+	if err != nil {
+		logger.Error("序列化任务结果失败", zap.String("job_id", job.job.ID), zap.Error(err))
+		return
+	}
+
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		err = postWebhook(job.callbackURL, body)
+		if err == nil {
+			logger.Info("异步图片任务回调成功", zap.String("job_id", job.job.ID))
+			return
+		}
+		logger.Warn("异步图片任务回调失败",
+			zap.String("job_id", job.job.ID),
+			zap.Int("attempt", attempt),
+			zap.Error(err),
+		)
+		if attempt < webhookAttempts {
+			time.Sleep(webhookRetryWait * time.Duration(attempt))
+		}
+	}
+}
+
+// postWebhook 发送一次回调请求，2xx 视为成功
+func postWebhook(callbackURL string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "monica-proxy")
+
+	resp, err := utils.WebhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// cleanupLoop 定期删除已完成且超过保留时间的任务
+func (s *imageJobService) cleanupLoop() {
+	ticker := time.NewTicker(imageJobCleanupInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		deadline := time.Now().Add(-s.config.Image.JobTTL).Unix()
+		s.mu.Lock()
+		for id, job := range s.jobs {
+			if job.job.CompletedAt > 0 && job.job.CompletedAt < deadline {
+				delete(s.jobs, id)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// jobErrorMessage 获取返回给客户端的错误信息，原始错误只写入服务端日志，避免泄露上游细节
+func jobErrorMessage(err error) string {
+	if appErr, ok := err.(*errors.AppError); ok {
+		return appErr.Message
+	}
+	return errors.NewInternalError(err).Message
+}
@@ -2,39 +2,81 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/errors"
 	"monica-proxy/internal/logger"
 	"monica-proxy/internal/monica"
+	"monica-proxy/internal/storage"
 	"monica-proxy/internal/types"
+	"strings"
+	"time"
 
+	lop "github.com/samber/lo/parallel"
 	"go.uber.org/zap"
 )
 
+// 图片响应格式
+const (
+	imageResponseFormatURL     = "url"
+	imageResponseFormatB64JSON = "b64_json"
+)
+
+// maxImageCount 单个请求最多生成的图片数，与 OpenAI 一致
+const maxImageCount = 10
+
+// promptEnhanceTimeout 提示词优化的超时时间，超时后使用原始提示词
+const promptEnhanceTimeout = 30 * time.Second
+
+// promptEnhanceInstruction 提示词优化的指令
+const promptEnhanceInstruction = `You are a prompt writer for the SDXL text-to-image model.
+Rewrite the image description below into a single detailed English prompt: translate it to English if needed, keep every subject and constraint from the original, and add concrete details about composition, lighting and style.
+Reply with the prompt text only, without quotes, explanations or prefixes.
+
+Image description:
+`
+
+// ImageContentPath 本地图片代理的路由前缀
+const ImageContentPath = "/v1/images/content/"
+
 // ImageService 图像服务接口
 type ImageService interface {
-	// GenerateImage 生成图像
-	GenerateImage(ctx context.Context, req *types.ImageGenerationRequest) (*types.ImageGenerationResponse, error)
+	// GenerateImage 生成图像，baseURL 为本地图片代理地址的前缀
+	GenerateImage(ctx context.Context, req *types.ImageGenerationRequest, baseURL string) (*types.ImageGenerationResponse, error)
+	// GetImagePath 获取本地保存的图片路径
+	GetImagePath(id string) (string, error)
 }
 
 // imageService 图像服务实现
 type imageService struct {
 	config *config.Config
+	store  *storage.ImageStore
 }
 
-// NewImageService 创建图像服务实例
-func NewImageService(cfg *config.Config) ImageService {
+// NewImageService 创建图像服务实例，store 为 nil 时不启用本地图片代理
+func NewImageService(cfg *config.Config, store *storage.ImageStore) ImageService {
 	return &imageService{
 		config: cfg,
+		store:  store,
 	}
 }
 
 // GenerateImage 生成图像
-func (s *imageService) GenerateImage(ctx context.Context, req *types.ImageGenerationRequest) (*types.ImageGenerationResponse, error) {
+func (s *imageService) GenerateImage(ctx context.Context, req *types.ImageGenerationRequest, baseURL string) (*types.ImageGenerationResponse, error) {
 	// 验证请求
 	if req.Prompt == "" {
 		return nil, errors.NewInvalidInputError("提示词不能为空", nil)
 	}
+	if err := validateResponseFormat(req.ResponseFormat); err != nil {
+		return nil, err
+	}
+	if req.N > maxImageCount {
+		return nil, errors.NewInvalidInputError(fmt.Sprintf("n 不能超过 %d", maxImageCount), nil)
+	}
+	if err := monica.CheckAccount(); err != nil {
+		return nil, err
+	}
 
 	// 设置默认值
 	if req.Model == "" {
@@ -54,6 +96,15 @@ func (s *imageService) GenerateImage(ctx context.Context, req *types.ImageGenera
 		zap.Int("count", req.N),
 	)
 
+	// 使用聊天模型优化提示词，失败时使用原始提示词
+	if s.config.Image.PromptEnhance {
+		if revised, err := s.enhancePrompt(ctx, req.Prompt); err != nil {
+			logger.Warn("优化提示词失败，使用原始提示词", zap.Error(err))
+		} else {
+			req.Prompt = revised
+		}
+	}
+
 	// 调用Monica API生成图像
 	response, err := monica.GenerateImage(ctx, s.config, req)
 	if err != nil {
@@ -61,5 +112,87 @@ func (s *imageService) GenerateImage(ctx context.Context, req *types.ImageGenera
 		return nil, errors.NewImageGenerationError(err)
 	}
 
+	// 按响应格式处理 Monica CDN 地址
+	if err := s.formatImages(ctx, response.Data, req.ResponseFormat, baseURL); err != nil {
+		logger.Error("处理生成的图像失败", zap.Error(err))
+		return nil, errors.NewImageGenerationError(err)
+	}
+
 	return response, nil
 }
+
+// enhancePrompt 使用配置的聊天模型扩写提示词并翻译为英文
+func (s *imageService) enhancePrompt(ctx context.Context, prompt string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, promptEnhanceTimeout)
+	defer cancel()
+
+	content, err := completeText(ctx, s.config, s.config.Image.PromptEnhanceModel, promptEnhanceInstruction+prompt)
+	if err != nil {
+		return "", err
+	}
+
+	revised := strings.Trim(strings.TrimSpace(content), `"'`)
+	if revised == "" {
+		return "", fmt.Errorf("empty revised prompt")
+	}
+
+	logger.Info("提示词已优化",
+		zap.Int("original_length", len(prompt)),
+		zap.Int("revised_length", len(revised)),
+	)
+	return revised, nil
+}
+
+// GetImagePath 获取本地保存的图片路径
+func (s *imageService) GetImagePath(id string) (string, error) {
+	if s.store == nil {
+		return "", errors.NewNotFoundError("图片代理未启用")
+	}
+	path, ok := s.store.Path(id)
+	if !ok {
+		return "", errors.NewNotFoundError("图片不存在或已过期")
+	}
+	return path, nil
+}
+
+// formatImages 下载 Monica 生成的图片，b64_json 格式内联返回，启用代理时替换为本地地址
+func (s *imageService) formatImages(ctx context.Context, images []types.ImageGenerationData, format, baseURL string) error {
+	if format != imageResponseFormatB64JSON && s.store == nil {
+		return nil
+	}
+
+	errs := lop.Map(images, func(image types.ImageGenerationData, i int) error {
+		data, err := monica.DownloadImage(ctx, image.URL)
+		if err != nil {
+			return err
+		}
+
+		if format == imageResponseFormatB64JSON {
+			images[i].B64JSON = base64.StdEncoding.EncodeToString(data)
+			images[i].URL = ""
+			return nil
+		}
+
+		id, err := s.store.Save(data)
+		if err != nil {
+			return err
+		}
+		images[i].URL = baseURL + ImageContentPath + id
+		return nil
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateResponseFormat 验证图片响应格式
+func validateResponseFormat(format string) error {
+	if format != "" && format != imageResponseFormatURL && format != imageResponseFormatB64JSON {
+		return errors.NewInvalidInputError("response_format 只支持 url 或 b64_json", nil)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"fmt"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/inflight"
+	"monica-proxy/internal/logger"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// completionIDPrefix 聊天响应ID的前缀，响应ID由前缀和请求ID组成
+const completionIDPrefix = "chatcmpl-"
+
+// RequestService 正在处理的请求的查询和取消
+type RequestService interface {
+	// ListRequests 获取正在处理的请求
+	ListRequests() []inflight.Info
+	// CancelRequest 按请求ID或聊天响应ID取消请求，source 为取消的来源，记录在日志中
+	CancelRequest(id, source string) error
+}
+
+// requestService 正在处理的请求服务实现
+type requestService struct {
+	requests *inflight.Registry
+}
+
+// NewRequestService 创建请求服务实例
+func NewRequestService(requests *inflight.Registry) RequestService {
+	return &requestService{requests: requests}
+}
+
+// ListRequests 获取正在处理的请求
+func (s *requestService) ListRequests() []inflight.Info {
+	return s.requests.List()
+}
+
+// CancelRequest 取消请求的 context，上游请求随之中断，流式响应以 cancelled 结束
+func (s *requestService) CancelRequest(id, source string) error {
+	info, ok := s.requests.Cancel(id)
+	if !ok {
+		if requestID, found := strings.CutPrefix(id, completionIDPrefix); found {
+			info, ok = s.requests.Cancel(requestID)
+		}
+	}
+	if !ok {
+		return errors.NewNotFoundError(fmt.Sprintf("请求不存在或已结束: %s", id))
+	}
+
+	logger.Info("请求已取消",
+		zap.String("request_id", info.ID),
+		zap.String("source", source),
+		zap.String("path", info.Path),
+		zap.String("model", info.Model),
+		zap.String("api_key", info.APIKey),
+		zap.Int64("elapsed_ms", info.ElapsedMs),
+	)
+	return nil
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"monica-proxy/internal/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileRecord 保存的文件记录，包含返回给客户端的文件对象和 Monica 的文件信息
+type FileRecord struct {
+	types.FileObject
+	FileInfo types.FileInfo `json:"file_info"`
+}
+
+// Expired 记录对应的 Monica 文件是否已过期
+// 没有过期时间的旧记录按创建时间加 ttl 计算，ttl 为 0 时视为不过期
+func (r *FileRecord) Expired(now time.Time, ttl time.Duration) bool {
+	expiresAt := r.ExpiresAt
+	if expiresAt == 0 && ttl > 0 {
+		expiresAt = r.CreatedAt + int64(ttl/time.Second)
+	}
+	return expiresAt > 0 && now.Unix() >= expiresAt
+}
+
+// FileStore 通过 /v1/files 上传的文件记录，持久化为本地JSON文件
+// 过期的记录在加载和每次写入时清理，避免文件无限增长
+type FileStore struct {
+	mu    sync.RWMutex
+	path  string
+	ttl   time.Duration
+	files map[string]*FileRecord
+}
+
+// NewFileStore 创建文件存储并加载未过期的记录，path 为空时只保存在内存中
+// ttl 为上传缓存的有效期，用于判断没有过期时间的旧记录
+func NewFileStore(path string, ttl time.Duration) (*FileStore, error) {
+	s := &FileStore{
+		path:  path,
+		ttl:   ttl,
+		files: make(map[string]*FileRecord),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read file store failed: %w", err)
+	}
+
+	var records []*FileRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("parse file store failed: %w", err)
+	}
+	now := time.Now()
+	for _, record := range records {
+		if !record.Expired(now, ttl) {
+			s.files[record.ID] = record
+		}
+	}
+	return s, nil
+}
+
+// Save 保存文件记录
+func (s *FileStore) Save(record *FileRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[record.ID] = record
+	if err := s.persist(); err != nil {
+		delete(s.files, record.ID)
+		return err
+	}
+	return nil
+}
+
+// Get 获取文件记录
+func (s *FileStore) Get(id string) (*FileRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.files[id]
+	return record, ok
+}
+
+// List 按创建时间倒序列出文件记录，purpose 为空时返回全部
+func (s *FileStore) List(purpose string) []*FileRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]*FileRecord, 0, len(s.files))
+	for _, record := range s.files {
+		if purpose == "" || record.Purpose == purpose {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].CreatedAt == records[j].CreatedAt {
+			return records[i].ID > records[j].ID
+		}
+		return records[i].CreatedAt > records[j].CreatedAt
+	})
+	return records
+}
+
+// Delete 删除文件记录，返回记录是否存在
+func (s *FileStore) Delete(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.files[id]
+	if !ok {
+		return false, nil
+	}
+	delete(s.files, id)
+	if err := s.persist(); err != nil {
+		s.files[id] = record
+		return false, err
+	}
+	return true, nil
+}
+
+// persist 清理过期记录后将全部记录写入磁盘，先写临时文件再重命名，避免写到一半时损坏
+// 调用方需持有写锁
+func (s *FileStore) persist() error {
+	now := time.Now()
+	for id, record := range s.files {
+		if record.Expired(now, s.ttl) {
+			delete(s.files, id)
+		}
+	}
+	if s.path == "" {
+		return nil
+	}
+
+	records := make([]*FileRecord, 0, len(s.files))
+	for _, record := range s.files {
+		records = append(records, record)
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("create file store dir failed: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write file store failed: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("write file store failed: %w", err)
+	}
+	return nil
+}
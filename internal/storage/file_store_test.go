@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"encoding/json"
+	"monica-proxy/internal/types"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newRecord 创建测试用的文件记录
+func newRecord(id string, createdAt, expiresAt time.Time) *FileRecord {
+	record := &FileRecord{FileObject: types.FileObject{ID: id, CreatedAt: createdAt.Unix()}}
+	if !expiresAt.IsZero() {
+		record.ExpiresAt = expiresAt.Unix()
+	}
+	return record
+}
+
+func TestFileStorePrunesExpiredRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "files.json")
+	now := time.Now()
+	ttl := time.Hour
+	records := []*FileRecord{
+		newRecord("file-fresh", now, now.Add(ttl)),
+		newRecord("file-expired", now.Add(-2*ttl), now.Add(-ttl)),
+		newRecord("file-legacy-fresh", now.Add(-ttl/2), time.Time{}),
+		newRecord("file-legacy-expired", now.Add(-2*ttl), time.Time{}),
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewFileStore(path, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		id   string
+		want bool
+	}{
+		{"file-fresh", true},
+		{"file-expired", false},
+		{"file-legacy-fresh", true},
+		{"file-legacy-expired", false},
+	} {
+		if _, ok := store.Get(tt.id); ok != tt.want {
+			t.Errorf("Get(%s) found = %v after load, want %v", tt.id, ok, tt.want)
+		}
+	}
+
+	// 写入时清理内存中已经过期的记录
+	store.files["file-stale"] = newRecord("file-stale", now.Add(-2*ttl), now.Add(-time.Second))
+	if err := store.Save(newRecord("file-new", now, now.Add(ttl))); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved []*FileRecord
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]bool)
+	for _, record := range saved {
+		ids[record.ID] = true
+	}
+	if len(ids) != 3 || !ids["file-fresh"] || !ids["file-legacy-fresh"] || !ids["file-new"] {
+		t.Errorf("saved records = %v, want file-fresh, file-legacy-fresh and file-new", ids)
+	}
+}
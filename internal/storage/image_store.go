@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"monica-proxy/internal/logger"
+	"monica-proxy/internal/utils"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// imageStoreCleanupInterval 过期图片的清理间隔
+const imageStoreCleanupInterval = time.Hour
+
+// imageIDPattern 图片ID格式，防止通过ID访问存储目录以外的文件
+var imageIDPattern = regexp.MustCompile(`^[0-9a-f]{32}\.(png|jpg|gif|webp)$`)
+
+// imageExtensions 图片MIME类型对应的扩展名
+var imageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// ImageStore 将生成的图片保存在本地目录，通过代理路由对外提供访问
+type ImageStore struct {
+	dir string
+	ttl time.Duration
+}
+
+// NewImageStore 创建图片存储，ttl 大于0时定期清理过期的图片
+func NewImageStore(dir string, ttl time.Duration) (*ImageStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create image store dir failed: %w", err)
+	}
+	s := &ImageStore{
+		dir: dir,
+		ttl: ttl,
+	}
+	if ttl > 0 {
+		go s.cleanupLoop()
+	}
+	return s, nil
+}
+
+// Save 保存图片，返回图片ID（包含扩展名）
+func (s *ImageStore) Save(data []byte) (string, error) {
+	ext, ok := imageExtensions[utils.DetectImageType(data)]
+	if !ok {
+		return "", fmt.Errorf("unsupported image type: %s", utils.DetectImageType(data))
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(buf) + ext
+
+	path := filepath.Join(s.dir, id)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return "", fmt.Errorf("write image failed: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("write image failed: %w", err)
+	}
+	return id, nil
+}
+
+// Path 获取图片的本地路径，图片不存在时返回 false
+func (s *ImageStore) Path(id string) (string, bool) {
+	if !imageIDPattern.MatchString(id) {
+		return "", false
+	}
+	path := filepath.Join(s.dir, id)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// Cleanup 删除超过有效期的图片，返回删除的数量
+func (s *ImageStore) Cleanup() (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	deadline := time.Now().Add(-s.ttl)
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(deadline) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, entry.Name())); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// cleanupLoop 定期清理过期图片
+func (s *ImageStore) cleanupLoop() {
+	ticker := time.NewTicker(imageStoreCleanupInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		removed, err := s.Cleanup()
+		if err != nil {
+			logger.Warn("清理过期图片失败", zap.String("dir", s.dir), zap.Error(err))
+			continue
+		}
+		if removed > 0 {
+			logger.Info("已清理过期图片", zap.Int("count", removed))
+		}
+	}
+}
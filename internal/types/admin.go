@@ -0,0 +1,22 @@
+package types
+
+// AdminAccount 管理接口展示的 Monica 账号状态，不包含 Cookie
+type AdminAccount struct {
+	// ID Cookie 的哈希，与上传缓存中的账号标识一致
+	ID            string      `json:"id"`
+	BaseURL       string      `json:"base_url"`
+	CustomBotMode bool        `json:"custom_bot_mode"`
+	BotUID        string      `json:"bot_uid,omitempty"`
+	Disabled      bool        `json:"disabled"` // 被管理员禁用时不接受新的聊天、图片和上传请求
+	Health        HealthCheck `json:"health"`
+}
+
+// AdminCacheStats 管理接口展示的缓存统计
+type AdminCacheStats struct {
+	Upload UploadCacheStats `json:"upload"`
+}
+
+// AdminLogLevel 日志级别的查询结果和修改请求
+type AdminLogLevel struct {
+	Level string `json:"level"`
+}
@@ -0,0 +1,177 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/utils"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// documentType 支持的文档类型
+type documentType struct {
+	ext   string // 文件扩展名
+	sniff string // http.DetectContentType 的预期结果前缀
+}
+
+// SupportedDocumentTypes 支持通过 file_with_text 发送给 Monica 的文档格式
+var SupportedDocumentTypes = map[string]documentType{
+	"application/pdf":    {ext: ".pdf", sniff: "application/pdf"},
+	"application/msword": {ext: ".doc", sniff: "application/octet-stream"},
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": {ext: ".docx", sniff: "application/zip"},
+	"application/vnd.ms-excel": {ext: ".xls", sniff: "application/octet-stream"},
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         {ext: ".xlsx", sniff: "application/zip"},
+	"application/vnd.ms-powerpoint":                                             {ext: ".ppt", sniff: "application/octet-stream"},
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": {ext: ".pptx", sniff: "application/zip"},
+	"text/plain":       {ext: ".txt", sniff: "text/plain"},
+	"text/markdown":    {ext: ".md", sniff: "text/plain"},
+	"text/csv":         {ext: ".csv", sniff: "text/plain"},
+	"application/json": {ext: ".json", sniff: "text/plain"},
+}
+
+// UploadMessageFile 处理消息中的 file 内容片段
+// file_data 会上传到Monica，file_id 则引用已经上传过的文件
+func UploadMessageFile(ctx context.Context, cfg *config.Config, file *ChatMessageFile) (*FileInfo, error) {
+	switch {
+	case file.Resolved != nil:
+		return file.Resolved, nil
+	case file.FileData != "":
+		return UploadBase64Document(ctx, cfg, file.FileData, file.Filename)
+	case file.FileID != "":
+		return GetUploadedFile(ctx, cfg, file.FileID)
+	default:
+		return nil, fmt.Errorf("file part must contain file_data or file_id")
+	}
+}
+
+// UploadBase64Document 上传 data URI 格式的文档到Monica
+func UploadBase64Document(ctx context.Context, cfg *config.Config, fileData, fileName string) (*FileInfo, error) {
+	// 解析 data URI，部分客户端只发送base64内容
+	mimeType := ""
+	encoded := fileData
+	if strings.HasPrefix(fileData, "data:") {
+		parts := strings.SplitN(fileData, ",", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid base64 file format")
+		}
+		mimeType = strings.TrimSuffix(strings.TrimPrefix(parts[0], "data:"), ";base64")
+		encoded = parts[1]
+	}
+
+	data, err := utils.Base64Decode(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decode base64 failed: %v", err)
+	}
+
+	return uploadDocumentData(ctx, cfg, data, mimeType, fileName)
+}
+
+// UploadFileData 上传原始文件数据到Monica，mimeType 为空时根据内容和文件名判断
+func UploadFileData(ctx context.Context, cfg *config.Config, data []byte, mimeType, fileName string) (*FileInfo, error) {
+	if mimeType == "" {
+		if contentType := utils.DetectImageType(data); strings.HasPrefix(contentType, "image/") {
+			mimeType = contentType
+		}
+	}
+
+	return uploadDocumentData(ctx, cfg, data, mimeType, fileName)
+}
+
+// uploadDocumentData 校验并上传文件，图片走图片的校验逻辑
+func uploadDocumentData(ctx context.Context, cfg *config.Config, data []byte, mimeType, fileName string) (*FileInfo, error) {
+	if strings.HasPrefix(mimeType, "image/") {
+		return uploadImageData(ctx, cfg, data, mimeType, "")
+	}
+
+	cacheKey := uploadCacheKey(cfg, data)
+	if fileInfo, ok := uploadCache.Get(cacheKey); ok {
+		return fileInfo, nil
+	}
+
+	// 验证文档格式和大小
+	fileInfo, err := validateDocumentBytes(data, mimeType, fileName)
+	if err != nil {
+		return nil, fmt.Errorf("validate document failed: %v", err)
+	}
+
+	return uploadFile(ctx, cfg, cacheKey, data, fileInfo, documentIndexAttempts)
+}
+
+// GetUploadedFile 通过 file_uid 获取已经上传到Monica的文件信息
+func GetUploadedFile(ctx context.Context, cfg *config.Config, fileUID string) (*FileInfo, error) {
+	var batchResp FileBatchGetResponse
+	_, err := utils.RestyDefaultClient.R().
+		SetContext(ctx).
+		SetHeader("cookie", cfg.Monica.Cookie).
+		SetBody(map[string][]string{"file_uids": {fileUID}}).
+		SetResult(&batchResp).
+		Post(FileGetURL)
+	if err != nil {
+		return nil, fmt.Errorf("batch get file failed: %v", err)
+	}
+	if len(batchResp.Data.Items) == 0 {
+		return nil, fmt.Errorf("file not found: %s", fileUID)
+	}
+
+	item := batchResp.Data.Items[0]
+	fileInfo := &FileInfo{
+		FileUID:     item.FileUid,
+		FileName:    item.FileName,
+		FileSize:    int64(item.FileSize),
+		FileType:    item.FileType,
+		FileExt:     item.FileType,
+		FileURL:     item.Url,
+		FileTokens:  item.FileTokens,
+		FileChunks:  item.FileChunks,
+		UseFullText: true,
+	}
+	if item.ErrorMessage != "" || item.FileChunks == 0 {
+		// 还没解析完成或解析失败，交给轮询逻辑处理
+		if err := waitFileIndexed(ctx, cfg, fileInfo, documentIndexAttempts); err != nil {
+			return nil, err
+		}
+	}
+	return fileInfo, nil
+}
+
+// validateDocumentBytes 验证文档字节数据的格式和大小
+// 声明的MIME类型不可用时根据文件扩展名推断，并用内容嗅探校验是否一致
+func validateDocumentBytes(data []byte, mimeType, fileName string) (*FileInfo, error) {
+	if len(data) > MaxFileSize {
+		return nil, fmt.Errorf("file size exceeds limit: %d > %d", len(data), MaxFileSize)
+	}
+
+	docType, ok := SupportedDocumentTypes[mimeType]
+	if !ok {
+		ext := strings.ToLower(filepath.Ext(fileName))
+		for mt, dt := range SupportedDocumentTypes {
+			if dt.ext == ext {
+				mimeType, docType, ok = mt, dt, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unsupported document type: %s", mimeType)
+	}
+
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, docType.sniff) {
+		return nil, fmt.Errorf("document content does not match type %s: %s", mimeType, contentType)
+	}
+
+	if fileName == "" {
+		fileName = uuid.New().String() + docType.ext
+	}
+
+	return &FileInfo{
+		FileName: fileName,
+		FileSize: int64(len(data)),
+		FileType: mimeType,
+		Parse:    true,
+	}, nil
+}
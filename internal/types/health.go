@@ -0,0 +1,21 @@
+package types
+
+// 健康检查状态
+const (
+	HealthStatusOK   = "ok"
+	HealthStatusFail = "fail"
+)
+
+// HealthCheck 单项就绪检查的结果
+type HealthCheck struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	// CheckedAt 检查时间，上游探测的结果会被缓存，可以据此判断结果是否较旧
+	CheckedAt int64 `json:"checked_at,omitempty"`
+}
+
+// ReadinessResponse /readyz 的响应
+type ReadinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
@@ -2,54 +2,54 @@ package types
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"monica-proxy/internal/config"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/tracing"
 	"monica-proxy/internal/utils"
 	"net/http"
 	"strings"
-	"sync"
-	"time"
 
-	"github.com/cespare/xxhash/v2"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const MaxFileSize = 10 * 1024 * 1024 // 10MB
 
-var imageCache sync.Map
-
-// sampleAndHash 对base64字符串进行采样并计算xxHash
-func sampleAndHash(data string) string {
-	// 如果数据长度小于1024，直接计算整个字符串的哈希
-	if len(data) <= 1024 {
-		return fmt.Sprintf("%x", xxhash.Sum64String(data))
+// UploadImageURL 上传消息中的图片，支持 data URI 和 http(s) 远程地址
+// detail 为 OpenAI 的 detail 参数(low/high/auto)，决定预处理时的缩放尺寸
+func UploadImageURL(ctx context.Context, cfg *config.Config, imageURL, detail string) (*FileInfo, error) {
+	switch {
+	case strings.HasPrefix(imageURL, "data:"):
+		return UploadBase64Image(ctx, cfg, imageURL, detail)
+	case strings.HasPrefix(imageURL, "http://"), strings.HasPrefix(imageURL, "https://"):
+		return UploadRemoteImage(ctx, cfg, imageURL, detail)
+	default:
+		return nil, fmt.Errorf("unsupported image url format")
 	}
-
-	// 采样策略：
-	// 1. 取前256字节
-	// 2. 取中间256字节
-	// 3. 取最后256字节
-	var samples []string
-	samples = append(samples, data[:256])
-	mid := len(data) / 2
-	samples = append(samples, data[mid-128:mid+128])
-	samples = append(samples, data[len(data)-256:])
-
-	// 将采样数据拼接后计算哈希
-	return fmt.Sprintf("%x", xxhash.Sum64String(strings.Join(samples, "")))
 }
 
-// UploadBase64Image 上传base64编码的图片到Monica
-func UploadBase64Image(ctx context.Context, cfg *config.Config, base64Data string) (*FileInfo, error) {
-	// 1. 生成缓存key
-	cacheKey := sampleAndHash(base64Data)
+// UploadRemoteImage 下载远程图片后上传到Monica
+func UploadRemoteImage(ctx context.Context, cfg *config.Config, imageURL, detail string) (*FileInfo, error) {
+	if !cfg.Upload.RemoteFetchEnabled {
+		return nil, fmt.Errorf("remote image urls are disabled")
+	}
 
-	// 2. 检查缓存
-	if value, exists := imageCache.Load(cacheKey); exists {
-		return value.(*FileInfo), nil
+	imageData, mimeType, err := utils.FetchRemoteFile(ctx, imageURL)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(mimeType, "image/") {
+		return nil, fmt.Errorf("invalid image mime type: %s", mimeType)
 	}
 
-	// 3. 解析base64数据
+	return uploadImageData(ctx, cfg, imageData, mimeType, detail)
+}
+
+// UploadBase64Image 上传base64编码的图片到Monica
+func UploadBase64Image(ctx context.Context, cfg *config.Config, base64Data, detail string) (*FileInfo, error) {
+	// 1. 解析base64数据
 	// 移除 "data:image/png;base64," 这样的前缀
 	parts := strings.Split(base64Data, ",")
 	if len(parts) != 2 {
@@ -68,114 +68,66 @@ func UploadBase64Image(ctx context.Context, cfg *config.Config, base64Data strin
 		return nil, fmt.Errorf("decode base64 failed: %v", err)
 	}
 
-	// 4. 验证图片格式和大小
-	fileInfo, err := validateImageBytes(imageData, mimeType)
-	if err != nil {
-		return nil, fmt.Errorf("validate image failed: %v", err)
-	}
-	// log.Printf("file info: %+v", fileInfo)
-
-	// 5. 获取预签名URL
-	preSignReq := &PreSignRequest{
-		FilenameList: []string{fileInfo.FileName},
-		Module:       ImageModule,
-		Location:     ImageLocation,
-		ObjID:        uuid.New().String(),
-	}
-
-	var preSignResp PreSignResponse
-	_, err = utils.RestyDefaultClient.R().
-		SetContext(ctx).
-		SetHeader("cookie", cfg.Monica.Cookie).
-		SetBody(preSignReq).
-		SetResult(&preSignResp).
-		Post(PreSignURL)
-
-	if err != nil {
-		return nil, fmt.Errorf("get pre-sign url failed: %v", err)
-	}
-
-	if len(preSignResp.Data.PreSignURLList) == 0 || len(preSignResp.Data.ObjectURLList) == 0 {
-		return nil, fmt.Errorf("no pre-sign url or object url returned")
-	}
-	// log.Printf("preSign info: %+v", preSignResp)
-
-	// 6. 上传图片数据
-	_, err = utils.RestyDefaultClient.R().
-		SetContext(ctx).
-		SetHeader("Content-Type", fileInfo.FileType).
-		SetBody(imageData).
-		Put(preSignResp.Data.PreSignURLList[0])
-
-	if err != nil {
-		return nil, fmt.Errorf("upload file failed: %v", err)
-	}
-
-	// 7. 创建文件对象
-	fileInfo.ObjectURL = preSignResp.Data.ObjectURLList[0]
-	uploadReq := &FileUploadRequest{
-		Data: []FileInfo{*fileInfo},
-	}
-
-	var uploadResp FileUploadResponse
-	_, err = utils.RestyDefaultClient.R().
-		SetContext(ctx).
-		SetHeader("cookie", cfg.Monica.Cookie).
-		SetBody(uploadReq).
-		SetResult(&uploadResp).
-		Post(FileUploadURL)
-
-	if err != nil {
-		return nil, fmt.Errorf("create file object failed: %v", err)
-	}
-	// log.Printf("uploadResp: %+v", uploadResp)
-	if len(uploadResp.Data.Items) > 0 {
-		fileInfo.FileName = uploadResp.Data.Items[0].FileName
-		fileInfo.FileType = uploadResp.Data.Items[0].FileType
-		fileInfo.FileSize = uploadResp.Data.Items[0].FileSize
-		fileInfo.FileUID = uploadResp.Data.Items[0].FileUID
-		fileInfo.FileExt = uploadResp.Data.Items[0].FileType
-		fileInfo.FileTokens = uploadResp.Data.Items[0].FileTokens
-		fileInfo.FileChunks = uploadResp.Data.Items[0].FileChunks
-	}
+	return uploadImageData(ctx, cfg, imageData, mimeType, detail)
+}
 
-	fileInfo.UseFullText = true
-	fileInfo.FileURL = preSignResp.Data.CDNURLList[0]
-
-	// 8. 获取文件llm读取结果知道有返回
-	var batchResp FileBatchGetResponse
-	reqMap := make(map[string][]string)
-	reqMap["file_uids"] = []string{fileInfo.FileUID}
-	var retryCount = 1
-	for {
-		if retryCount > 5 {
-			return nil, fmt.Errorf("retry limit exceeded")
+// uploadImageData 预处理并验证图片后上传到Monica
+func uploadImageData(ctx context.Context, cfg *config.Config, imageData []byte, mimeType, detail string) (fileInfo *FileInfo, err error) {
+	ctx, span := tracing.Start(ctx, "upload.image",
+		attribute.String("file.mime_type", mimeType),
+		attribute.Int("file.size", len(imageData)),
+		attribute.String("image.detail", detail),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	// 2. 按原始内容检查缓存，同一张图片无论以base64还是URL发送都能命中
+	// 不同 detail 的预处理结果不同，需要分开缓存
+	cacheKey := uploadCacheKey(cfg, imageData)
+	if cfg.Upload.ImagePreprocess && detail == "low" {
+		cacheKey += ":low"
+	}
+	if fileInfo, ok := uploadCache.Get(cacheKey); ok {
+		span.SetAttributes(attribute.Bool("upload.cache_hit", true))
+		return fileInfo, nil
+	}
+	span.SetAttributes(attribute.Bool("upload.cache_hit", false))
+
+	// 3. 缩小尺寸、去除元数据并转换不支持的格式
+	if cfg.Upload.ImagePreprocess {
+		_, preprocessSpan := tracing.Start(ctx, "upload.preprocess")
+		processed, processedType, err := preprocessImage(cfg, imageData, detail)
+		tracing.End(preprocessSpan, err)
+		if stderrors.Is(err, utils.ErrImageTooLarge) {
+			return nil, errors.NewInvalidInputError("图片像素数超过限制", err)
 		}
-		_, err = utils.RestyDefaultClient.R().
-			SetContext(ctx).
-			SetHeader("cookie", cfg.Monica.Cookie).
-			SetBody(reqMap).
-			SetResult(&batchResp).
-			Post(FileGetURL)
 		if err != nil {
-			return nil, fmt.Errorf("batch get file failed: %v", err)
+			return nil, fmt.Errorf("preprocess image failed: %v", err)
 		}
-		if len(batchResp.Data.Items) > 0 && batchResp.Data.Items[0].FileChunks > 0 {
-			break
-		} else {
-			retryCount++
-		}
-		time.Sleep(1 * time.Second)
+		imageData, mimeType = processed, processedType
+	}
+
+	// 4. 验证图片格式和大小
+	fileInfo, err = validateImageBytes(imageData, mimeType)
+	if err != nil {
+		return nil, fmt.Errorf("validate image failed: %v", err)
 	}
-	fileInfo.FileChunks = batchResp.Data.Items[0].FileChunks
-	fileInfo.FileTokens = batchResp.Data.Items[0].FileTokens
-	fileInfo.URL = ""
-	fileInfo.ObjectURL = ""
 
-	// 9. 保存到缓存
-	imageCache.Store(cacheKey, fileInfo)
+	return uploadFile(ctx, cfg, cacheKey, imageData, fileInfo, imageIndexAttempts)
+}
 
-	return fileInfo, nil
+// preprocessImage 按配置和 detail 参数预处理图片
+func preprocessImage(cfg *config.Config, imageData []byte, detail string) ([]byte, string, error) {
+	maxDimension := cfg.Upload.ImageMaxDimension
+	if detail == "low" {
+		maxDimension = cfg.Upload.ImageLowDetailDimension
+	}
+	return utils.PreprocessImage(imageData, utils.ImageProcessOptions{
+		MaxDimension:  maxDimension,
+		MaxPixels:     cfg.Upload.ImageMaxPixels,
+		MaxBytes:      MaxFileSize,
+		JPEGQuality:   cfg.Upload.ImageJPEGQuality,
+		StripMetadata: cfg.Upload.ImageStripMetadata,
+	})
 }
 
 // validateImageBytes 验证图片字节数据的格式和大小
@@ -0,0 +1,243 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/logger"
+	"strings"
+
+	"github.com/google/uuid"
+	lop "github.com/samber/lo/parallel"
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// messagePart 单条消息中按顺序排列的内容片段
+type messagePart struct {
+	text  string
+	image *openai.ChatMessageImageURL
+	file  *ChatMessageFile
+}
+
+// isAttachment 是否为需要上传的图片或文件
+func (p messagePart) isAttachment() bool {
+	return p.image != nil || p.file != nil
+}
+
+// uploadResult 单个附件的上传结果
+type uploadResult struct {
+	file *FileInfo
+	err  error
+}
+
+// convertMessages 将 OpenAI 消息列表转换为 Monica Item 列表
+// system 消息会被跳过，由调用方单独处理；返回的 Item 未设置 ParentItemID
+func convertMessages(ctx context.Context, cfg *config.Config, conversationID string, chatReq ChatCompletionRequest, incognito bool) ([]Item, error) {
+	items := make([]Item, 0, len(chatReq.Messages))
+	for i, msg := range chatReq.Messages {
+		if msg.Role == openai.ChatMessageRoleSystem {
+			continue
+		}
+
+		content, err := convertMessageContent(ctx, cfg, msg, chatReq.Files[i])
+		if err != nil {
+			return nil, err
+		}
+		content.IsIncognito = incognito
+
+		items = append(items, Item{
+			ConversationID: conversationID,
+			ItemID:         fmt.Sprintf("msg:%s", uuid.New().String()),
+			ItemType:       roleToItemType(msg.Role),
+			Data:           content,
+		})
+	}
+	return items, nil
+}
+
+// roleToItemType 将 OpenAI 角色映射为 Monica 的 item 类型
+func roleToItemType(role string) string {
+	if role == openai.ChatMessageRoleAssistant {
+		return "reply"
+	}
+	return "question"
+}
+
+// convertMessageContent 转换单条消息的内容，文本按顺序拼接，图片和文件上传后挂到 FileInfos
+// files 为该消息中 file 内容片段的数据，按片段下标索引
+func convertMessageContent(ctx context.Context, cfg *config.Config, msg openai.ChatCompletionMessage, files map[int]*ChatMessageFile) (ItemContent, error) {
+	if len(msg.MultiContent) == 0 {
+		return ItemContent{Type: "text", Content: msg.Content}, nil
+	}
+
+	var parts []messagePart
+	var attachments []messagePart
+	for j, content := range msg.MultiContent {
+		switch content.Type {
+		case openai.ChatMessagePartTypeText:
+			parts = append(parts, messagePart{text: content.Text})
+		case openai.ChatMessagePartTypeImageURL:
+			if content.ImageURL == nil || content.ImageURL.URL == "" {
+				continue
+			}
+			parts = append(parts, messagePart{image: content.ImageURL})
+			attachments = append(attachments, parts[len(parts)-1])
+		case ChatMessagePartTypeFile:
+			if files[j] == nil {
+				continue
+			}
+			parts = append(parts, messagePart{file: files[j]})
+			attachments = append(attachments, parts[len(parts)-1])
+		}
+	}
+
+	if len(attachments) == 0 {
+		return ItemContent{Type: "text", Content: joinTextParts(parts)}, nil
+	}
+
+	results, err := uploadAttachments(ctx, cfg, attachments)
+	if err != nil {
+		return ItemContent{}, err
+	}
+
+	// 只有附件后面还有文本时才需要标记附件位置，否则保持原有的纯文本内容
+	interleaved := false
+	seenAttachment := false
+	for _, part := range parts {
+		if part.isAttachment() {
+			seenAttachment = true
+		} else if seenAttachment && part.text != "" {
+			interleaved = true
+			break
+		}
+	}
+
+	var sb strings.Builder
+	fileInfos := make([]FileInfo, 0, len(results))
+	attachmentIndex := 0
+	for _, part := range parts {
+		if !part.isAttachment() {
+			appendText(&sb, part.text)
+			continue
+		}
+		result := results[attachmentIndex]
+		attachmentIndex++
+		if result.file == nil {
+			continue
+		}
+		fileInfos = append(fileInfos, *result.file)
+		if interleaved {
+			label := "image"
+			if part.file != nil {
+				label = "file"
+			}
+			appendText(&sb, fmt.Sprintf("[%s %d]", label, len(fileInfos)))
+		}
+	}
+
+	if len(fileInfos) == 0 {
+		return ItemContent{Type: "text", Content: sb.String()}, nil
+	}
+
+	return ItemContent{
+		Type:      "file_with_text",
+		Content:   sb.String(),
+		FileInfos: fileInfos,
+	}, nil
+}
+
+// uploadAttachments 并发上传图片和文件，结果顺序与输入一致
+// 图片上传失败时根据配置的策略决定是跳过该图片还是让整个请求失败；
+// 文件缺失对回答的影响更大，上传或解析失败时总是让请求失败
+func uploadAttachments(ctx context.Context, cfg *config.Config, attachments []messagePart) ([]uploadResult, error) {
+	// 为上传创建带超时的上下文，文档需要等待 Monica 分块索引，给更长的时间
+	timeout := ImageUploadTimeout
+	for _, item := range attachments {
+		if item.file != nil {
+			timeout = DocumentUploadTimeout
+			break
+		}
+	}
+	uploadCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	results := lop.Map(attachments, func(item messagePart, _ int) uploadResult {
+		var f *FileInfo
+		var err error
+		if item.file != nil {
+			f, err = UploadMessageFile(uploadCtx, cfg, item.file)
+		} else {
+			f, err = UploadImageURL(uploadCtx, cfg, item.image.URL, string(item.image.Detail))
+		}
+		if err == nil && f == nil {
+			err = fmt.Errorf("empty upload result")
+		}
+		if err != nil {
+			return uploadResult{err: err}
+		}
+
+		// 缓存中的 FileInfo 是共享的，需要复制后再写入 detail
+		file := *f
+		if item.image != nil && item.image.Detail != "" {
+			file.FileMetaInfo = map[string]any{"detail": string(item.image.Detail)}
+		}
+		return uploadResult{file: &file}
+	})
+
+	var failureCount int
+	for i, result := range results {
+		if result.err == nil {
+			continue
+		}
+		failureCount++
+		logger.Error("上传附件失败",
+			zap.Error(result.err),
+			zap.Bool("is_file", attachments[i].file != nil),
+			zap.Int("total_attachments", len(attachments)),
+		)
+		if attachments[i].file != nil || cfg.Monica.ImageUploadFailurePolicy == config.ImageUploadFailureFail {
+			if appErr, ok := result.err.(*errors.AppError); ok {
+				return nil, appErr
+			}
+			return nil, errors.NewFileUploadError(result.err)
+		}
+	}
+
+	// 记录上传统计信息
+	if failureCount > 0 {
+		logger.Warn("附件上传完成",
+			zap.Int("success_count", len(attachments)-failureCount),
+			zap.Int("failure_count", failureCount),
+			zap.Int("total_attachments", len(attachments)),
+		)
+	} else {
+		logger.Info("所有附件上传成功",
+			zap.Int("success_count", len(attachments)),
+			zap.Int("total_attachments", len(attachments)),
+		)
+	}
+
+	return results, nil
+}
+
+// joinTextParts 按顺序拼接所有文本片段
+func joinTextParts(parts []messagePart) string {
+	var sb strings.Builder
+	for _, part := range parts {
+		appendText(&sb, part.text)
+	}
+	return sb.String()
+}
+
+// appendText 以换行分隔追加文本
+func appendText(sb *strings.Builder, text string) {
+	if text == "" {
+		return
+	}
+	if sb.Len() > 0 {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(text)
+}
@@ -5,34 +5,52 @@ import (
 	"fmt"
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/logger"
-	"sync/atomic"
+	"monica-proxy/internal/tracing"
+	"strings"
 	"time"
 
-	lop "github.com/samber/lo/parallel"
-
 	"github.com/google/uuid"
-	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
+// DefaultMonicaBaseURL Monica API 的默认地址，可通过 MONICA_BASE_URL 指向 mock 等其他地址
+const DefaultMonicaBaseURL = "https://api.monica.im"
+
+// Monica API 的路径
 const (
-	BotChatURL    = "https://api.monica.im/api/custom_bot/chat"
-	PreSignURL    = "https://api.monica.im/api/file_object/pre_sign_list_by_module"
-	FileUploadURL = "https://api.monica.im/api/files/batch_create_llm_file"
-	FileGetURL    = "https://api.monica.im/api/files/batch_get_file"
+	BotChatPath    = "/api/custom_bot/chat"
+	PreSignPath    = "/api/file_object/pre_sign_list_by_module"
+	FileUploadPath = "/api/files/batch_create_llm_file"
+	FileGetPath    = "/api/files/batch_get_file"
 
 	// 图片生成相关 API
-	ImageGenerateURL = "https://api.monica.im/api/image_tools/text_to_image"
-	ImageResultURL   = "https://api.monica.im/api/image_tools/loop_result"
+	ImageGeneratePath = "/api/image_tools/text_to_image"
+	ImageResultPath   = "/api/image_tools/loop_result"
+)
+
+// Monica API 的完整地址，由 InitMonicaURLs 按配置的 base URL 设置，启动后只读
+var (
+	BotChatURL    = DefaultMonicaBaseURL + BotChatPath
+	PreSignURL    = DefaultMonicaBaseURL + PreSignPath
+	FileUploadURL = DefaultMonicaBaseURL + FileUploadPath
+	FileGetURL    = DefaultMonicaBaseURL + FileGetPath
+
+	ImageGenerateURL = DefaultMonicaBaseURL + ImageGeneratePath
+	ImageResultURL   = DefaultMonicaBaseURL + ImageResultPath
 )
 
+// ImageTaskTextToImage 文生图任务类型
+const ImageTaskTextToImage = "text_to_image"
+
 // 图片相关常量
 const (
-	MaxImageSize         = 10 * 1024 * 1024 // 10MB
-	ImageModule          = "chat_bot"
-	ImageLocation        = "files"
-	ImageUploadTimeout   = 30 * time.Second // 图片上传超时时间
-	MaxConcurrentUploads = 5                // 最大并发上传数
+	MaxImageSize          = 10 * 1024 * 1024 // 10MB
+	ImageModule           = "chat_bot"
+	ImageLocation         = "files"
+	ImageUploadTimeout    = 30 * time.Second // 图片上传超时时间
+	DocumentUploadTimeout = 3 * time.Minute  // 文档上传和解析超时时间
+	MaxConcurrentUploads  = 5                // 最大并发上传数
 )
 
 // 支持的图片格式
@@ -307,14 +325,43 @@ type BotToolData struct {
 	ScheduleTaskList []interface{} `json:"schedule_task_list"`
 }
 
-// Custom Bot相关的URL
+// Custom Bot相关的路径
 const (
-	CustomBotSaveURL    = "https://api.monica.im/api/custom_bot/save_bot"
-	CustomBotPublishURL = "https://api.monica.im/api/custom_bot/publish_bot"
-	CustomBotPinURL     = "https://api.monica.im/api/custom_bot/pin_bot"
-	CustomBotChatURL    = "https://api.monica.im/api/custom_bot/preview_chat"
+	CustomBotSavePath    = "/api/custom_bot/save_bot"
+	CustomBotPublishPath = "/api/custom_bot/publish_bot"
+	CustomBotPinPath     = "/api/custom_bot/pin_bot"
+	CustomBotChatPath    = "/api/custom_bot/preview_chat"
+)
+
+// Custom Bot相关的URL，由 InitMonicaURLs 设置
+var (
+	CustomBotSaveURL    = DefaultMonicaBaseURL + CustomBotSavePath
+	CustomBotPublishURL = DefaultMonicaBaseURL + CustomBotPublishPath
+	CustomBotPinURL     = DefaultMonicaBaseURL + CustomBotPinPath
+	CustomBotChatURL    = DefaultMonicaBaseURL + CustomBotChatPath
 )
 
+// InitMonicaURLs 按配置的 base URL 设置所有 Monica API 地址，应在处理请求之前调用
+func InitMonicaURLs(cfg *config.Config) {
+	base := strings.TrimRight(cfg.Monica.BaseURL, "/")
+	if base == "" {
+		base = DefaultMonicaBaseURL
+	}
+
+	BotChatURL = base + BotChatPath
+	PreSignURL = base + PreSignPath
+	FileUploadURL = base + FileUploadPath
+	FileGetURL = base + FileGetPath
+
+	ImageGenerateURL = base + ImageGeneratePath
+	ImageResultURL = base + ImageResultPath
+
+	CustomBotSaveURL = base + CustomBotSavePath
+	CustomBotPublishURL = base + CustomBotPublishPath
+	CustomBotPinURL = base + CustomBotPinPath
+	CustomBotChatURL = base + CustomBotChatPath
+}
+
 // GetSupportedModels 获取支持的模型列表
 func GetSupportedModels() []string {
 	models := []string{
@@ -357,16 +404,20 @@ func GetSupportedModels() []string {
 }
 
 // ChatGPTToMonica 将 ChatGPTRequest 转换为 MonicaRequest
-func ChatGPTToMonica(cfg *config.Config, chatReq openai.ChatCompletionRequest) (*MonicaRequest, error) {
+func ChatGPTToMonica(ctx context.Context, cfg *config.Config, chatReq ChatCompletionRequest) (mReq *MonicaRequest, err error) {
 	if len(chatReq.Messages) == 0 {
 		return nil, fmt.Errorf("empty messages")
 	}
 
+	ctx, span := tracing.Start(ctx, "convert.chatgpt_to_monica",
+		attribute.String("gen_ai.request.model", chatReq.Model),
+		attribute.Int("message_count", len(chatReq.Messages)),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	// 生成会话ID
 	conversationID := fmt.Sprintf("conv:%s", uuid.New().String())
 
-	// 转换消息
-
 	// 设置默认欢迎消息头，不加上就有几率去掉问题最后的十几个token，不清楚是不是bug
 	defaultItem := Item{
 		ItemID:         fmt.Sprintf("msg:%s", uuid.New().String()),
@@ -374,114 +425,22 @@ func ChatGPTToMonica(cfg *config.Config, chatReq openai.ChatCompletionRequest) (
 		ItemType:       "reply",
 		Data:           ItemContent{Type: "text", Content: "__RENDER_BOT_WELCOME_MSG__"},
 	}
-	var items = make([]Item, 1, len(chatReq.Messages))
-	items[0] = defaultItem
-	preItemID := defaultItem.ItemID
-
-	for _, msg := range chatReq.Messages {
-		if msg.Role == "system" {
-			// monica不支持设置prompt，所以直接跳过
-			continue
-		}
-		var msgContext string
-		var imgUrl []*openai.ChatMessageImageURL
-		if len(msg.MultiContent) > 0 { // 说明应该是多内容，可能是图片内容
-			for _, content := range msg.MultiContent {
-				switch content.Type {
-				case "text":
-					msgContext = content.Text
-				case "image_url":
-					imgUrl = append(imgUrl, content.ImageURL)
-				}
-			}
-		}
-		itemID := fmt.Sprintf("msg:%s", uuid.New().String())
-		itemType := "question"
-		if msg.Role == "assistant" {
-			itemType = "reply"
-		}
-
-		var content ItemContent
-		if len(imgUrl) > 0 {
-			// 为图片上传创建带超时的上下文
-			uploadCtx, cancel := context.WithTimeout(context.Background(), ImageUploadTimeout)
-			defer cancel()
-
-			// 统计上传成功和失败数量
-			var successCount, failureCount int64
-
-			// 并发上传图片并收集结果
-			uploadResults := lop.Map(imgUrl, func(item *openai.ChatMessageImageURL, _ int) *FileInfo {
-				f, err := UploadBase64Image(uploadCtx, cfg, item.URL)
-				if err != nil {
-					atomic.AddInt64(&failureCount, 1)
-					logger.Error("上传图片失败",
-						zap.Error(err),
-						zap.String("image_url", item.URL),
-						zap.Int("total_images", len(imgUrl)),
-					)
-					return nil // 返回 nil 表示失败
-				}
-
-				if f == nil {
-					atomic.AddInt64(&failureCount, 1)
-					logger.Warn("图片上传返回空结果", zap.String("image_url", item.URL))
-					return nil
-				}
-
-				atomic.AddInt64(&successCount, 1)
-				return f
-			})
-
-			// 过滤掉失败的上传，只保留成功的
-			fileIfoList := make([]FileInfo, 0, len(uploadResults))
-			for _, result := range uploadResults {
-				if result != nil {
-					fileIfoList = append(fileIfoList, *result)
-				}
-			}
-
-			// 记录上传统计信息
-			if failureCount > 0 {
-				logger.Warn("图片上传完成",
-					zap.Int64("success_count", successCount),
-					zap.Int64("failure_count", failureCount),
-					zap.Int("total_images", len(imgUrl)),
-				)
-			} else {
-				logger.Info("所有图片上传成功",
-					zap.Int64("success_count", successCount),
-					zap.Int("total_images", len(imgUrl)),
-				)
-			}
-
-			content = ItemContent{
-				Type:        "file_with_text",
-				Content:     msgContext,
-				FileInfos:   fileIfoList,
-				IsIncognito: true,
-			}
-		} else {
-			content = ItemContent{
-				Type:        "text",
-				Content:     msg.Content,
-				IsIncognito: true,
-			}
-		}
-
-		item := Item{
-			ConversationID: conversationID,
-			ItemID:         itemID,
-			ParentItemID:   preItemID,
-			ItemType:       itemType,
-			Data:           content,
-		}
-		items = append(items, item)
-		preItemID = itemID
+
+	// 转换消息，monica不支持设置prompt，system消息统一按策略处理
+	items, err := convertMessages(ctx, cfg, conversationID, chatReq, true)
+	if err != nil {
+		return nil, err
 	}
 
+	// 按策略注入system prompt
+	systemPrompt := extractSystemPrompt(chatReq.Messages)
+	items = applySystemPrompt(cfg.Monica.SystemPromptStrategy, systemPrompt, conversationID, items)
+
+	// 串联消息链
+	items, preItemID := linkItems(defaultItem, items)
+
 	// 构建请求
-	mReq := &MonicaRequest{
+	mReq = &MonicaRequest{
 		TaskUID: fmt.Sprintf("task:%s", uuid.New().String()),
 		BotUID:  modelToBot(chatReq.Model),
 		Data: DataField{
@@ -497,21 +456,21 @@ func ChatGPTToMonica(cfg *config.Config, chatReq openai.ChatCompletionRequest) (
 		TaskType: "chat",
 	}
 
-	// indent, err := json.MarshalIndent(mReq, "", "  ")
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// log.Printf("send: \n%s\n", indent)
-
 	return mReq, nil
 }
 
 // ChatGPTToCustomBot 转换ChatGPT请求到Custom Bot请求
-func ChatGPTToCustomBot(cfg *config.Config, chatReq openai.ChatCompletionRequest, botUID string) (*CustomBotRequest, error) {
+func ChatGPTToCustomBot(ctx context.Context, cfg *config.Config, chatReq ChatCompletionRequest, botUID string) (customBotReq *CustomBotRequest, err error) {
 	if len(chatReq.Messages) == 0 {
 		return nil, fmt.Errorf("empty messages")
 	}
 
+	ctx, span := tracing.Start(ctx, "convert.chatgpt_to_custom_bot",
+		attribute.String("gen_ai.request.model", chatReq.Model),
+		attribute.Int("message_count", len(chatReq.Messages)),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	// 生成会话ID
 	conversationID := fmt.Sprintf("conv:%s", uuid.New().String())
 
@@ -522,97 +481,22 @@ func ChatGPTToCustomBot(cfg *config.Config, chatReq openai.ChatCompletionRequest
 		ItemType:       "reply",
 		Data:           ItemContent{Type: "text", Content: "__RENDER_BOT_WELCOME_MSG__"},
 	}
-	var items = make([]Item, 1, len(chatReq.Messages))
-	items[0] = defaultItem
-	preItemID := defaultItem.ItemID
-
-	// 提取system消息作为prompt
-	var systemPrompt string
-	// 转换消息
-	for _, msg := range chatReq.Messages {
-		if msg.Role == "system" {
-			// 将system消息作为prompt
-			systemPrompt = msg.Content
-			continue
-		}
-
-		var msgContext string
-		var imgUrl []*openai.ChatMessageImageURL
-		if len(msg.MultiContent) > 0 {
-			for _, content := range msg.MultiContent {
-				switch content.Type {
-				case "text":
-					msgContext = content.Text
-				case "image_url":
-					imgUrl = append(imgUrl, content.ImageURL)
-				}
-			}
-		}
-
-		itemID := fmt.Sprintf("msg:%s", uuid.New().String())
-		itemType := "question"
-		if msg.Role == "assistant" {
-			itemType = "reply"
-		}
-
-		var content ItemContent
-		if len(imgUrl) > 0 {
-			// 处理图片上传
-			uploadCtx, cancel := context.WithTimeout(context.Background(), ImageUploadTimeout)
-			defer cancel()
-
-			var successCount, failureCount int64
-			uploadResults := lop.Map(imgUrl, func(item *openai.ChatMessageImageURL, _ int) *FileInfo {
-				f, err := UploadBase64Image(uploadCtx, cfg, item.URL)
-				if err != nil {
-					atomic.AddInt64(&failureCount, 1)
-					logger.Error("上传图片失败",
-						zap.Error(err),
-						zap.String("image_url", item.URL),
-					)
-					return nil
-				}
-				atomic.AddInt64(&successCount, 1)
-				return f
-			})
-
-			fileIfoList := make([]FileInfo, 0, len(uploadResults))
-			for _, result := range uploadResults {
-				if result != nil {
-					fileIfoList = append(fileIfoList, *result)
-				}
-			}
-
-			content = ItemContent{
-				Type:        "file_with_text",
-				Content:     msgContext,
-				FileInfos:   fileIfoList,
-				IsIncognito: false,
-			}
-		} else {
-			content = ItemContent{
-				Type:        "text",
-				Content:     msg.Content,
-				IsIncognito: false,
-			}
-		}
-
-		item := Item{
-			ConversationID: conversationID,
-			ItemID:         itemID,
-			ParentItemID:   preItemID,
-			ItemType:       itemType,
-			Data:           content,
-		}
-		items = append(items, item)
-		preItemID = itemID
+
+	// 转换消息，system消息作为bot的prompt
+	items, err := convertMessages(ctx, cfg, conversationID, chatReq, false)
+	if err != nil {
+		return nil, err
 	}
+	systemPrompt := extractSystemPrompt(chatReq.Messages)
+
+	// 串联消息链
+	items, preItemID := linkItems(defaultItem, items)
 
 	// 生成reply ID
 	preGeneratedReplyID := fmt.Sprintf("msg:%s", uuid.New().String())
 
 	// 构建请求
-	customBotReq := &CustomBotRequest{
+	customBotReq = &CustomBotRequest{
 		TaskUID: fmt.Sprintf("task:%s", uuid.New().String()),
 		BotUID:  botUID,
 		Data: CustomBotData{
@@ -653,3 +537,50 @@ func ChatGPTToCustomBot(cfg *config.Config, chatReq openai.ChatCompletionRequest
 
 	return customBotReq, nil
 }
+
+// linkItems 在消息列表前加上欢迎消息头，并按顺序设置 ParentItemID
+// 返回完整的消息链以及最后一条消息的ID
+func linkItems(head Item, items []Item) ([]Item, string) {
+	linked := make([]Item, 0, len(items)+1)
+	linked = append(linked, head)
+	preItemID := head.ItemID
+	for _, item := range items {
+		item.ParentItemID = preItemID
+		linked = append(linked, item)
+		preItemID = item.ItemID
+	}
+	return linked, preItemID
+}
+
+// cloneItems 复制消息链，使用新的会话ID和 Item ID 并保持父子关系
+// 返回新的会话ID、消息链以及最后一条消息的ID，附件信息与原消息链共用
+func cloneItems(items []Item) (string, []Item, string) {
+	conversationID := fmt.Sprintf("conv:%s", uuid.New().String())
+	cloned := make([]Item, len(items))
+	preItemID := ""
+	for i, item := range items {
+		item.ConversationID = conversationID
+		item.ItemID = fmt.Sprintf("msg:%s", uuid.New().String())
+		item.ParentItemID = preItemID
+		cloned[i] = item
+		preItemID = item.ItemID
+	}
+	return conversationID, cloned, preItemID
+}
+
+// Clone 复制请求作为独立的 Monica 会话，用于 n>1 时只转换一次请求
+func (r *MonicaRequest) Clone() *MonicaRequest {
+	clone := *r
+	clone.TaskUID = fmt.Sprintf("task:%s", uuid.New().String())
+	clone.Data.ConversationID, clone.Data.Items, clone.Data.PreParentItemID = cloneItems(r.Data.Items)
+	return &clone
+}
+
+// Clone 复制请求作为独立的 Monica 会话，用于 n>1 时只转换一次请求
+func (r *CustomBotRequest) Clone() *CustomBotRequest {
+	clone := *r
+	clone.TaskUID = fmt.Sprintf("task:%s", uuid.New().String())
+	clone.Data.ConversationID, clone.Data.Items, clone.Data.PreParentItemID = cloneItems(r.Data.Items)
+	clone.Data.PreGeneratedReplyID = fmt.Sprintf("msg:%s", uuid.New().String())
+	return &clone
+}
@@ -0,0 +1,60 @@
+package types
+
+import (
+	"context"
+	"monica-proxy/internal/config"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestMonicaRequestClone(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Monica.SystemPromptStrategy = config.SystemPromptPrepend
+	mReq, err := ChatGPTToMonica(context.Background(), cfg, ChatCompletionRequest{
+		ChatCompletionRequest: openai.ChatCompletionRequest{
+			Model: "gpt-4o",
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: "Hi"},
+				{Role: openai.ChatMessageRoleAssistant, Content: "Hello"},
+				{Role: openai.ChatMessageRoleUser, Content: "How are you?"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clone := mReq.Clone()
+	if clone.TaskUID == mReq.TaskUID || clone.Data.ConversationID == mReq.Data.ConversationID {
+		t.Fatal("clone shares task or conversation id with the original")
+	}
+	if len(clone.Data.Items) != len(mReq.Data.Items) {
+		t.Fatalf("clone has %d items, want %d", len(clone.Data.Items), len(mReq.Data.Items))
+	}
+	for i, item := range clone.Data.Items {
+		orig := mReq.Data.Items[i]
+		if item.ItemID == orig.ItemID {
+			t.Errorf("items[%d] shares item id with the original", i)
+		}
+		if item.ItemType != orig.ItemType || item.Data.Content != orig.Data.Content {
+			t.Errorf("items[%d] = %s %q, want %s %q", i, item.ItemType, item.Data.Content, orig.ItemType, orig.Data.Content)
+		}
+		if item.ConversationID != clone.Data.ConversationID {
+			t.Errorf("items[%d].ConversationID = %q, want %q", i, item.ConversationID, clone.Data.ConversationID)
+		}
+		wantParent := ""
+		if i > 0 {
+			wantParent = clone.Data.Items[i-1].ItemID
+		}
+		if item.ParentItemID != wantParent {
+			t.Errorf("items[%d].ParentItemID = %q, want %q", i, item.ParentItemID, wantParent)
+		}
+	}
+	if last := clone.Data.Items[len(clone.Data.Items)-1].ItemID; clone.Data.PreParentItemID != last {
+		t.Errorf("PreParentItemID = %q, want %q", clone.Data.PreParentItemID, last)
+	}
+	if mReq.Data.Items[1].ConversationID != mReq.Data.ConversationID {
+		t.Error("original request was modified")
+	}
+}
@@ -1,6 +1,10 @@
 package types
 
-import "github.com/sashabaranov/go-openai"
+import (
+	"encoding/json"
+
+	"github.com/sashabaranov/go-openai"
+)
 
 // ImageGenerationRequest represents a request to create an image using DALL-E
 type ImageGenerationRequest struct {
@@ -12,6 +16,10 @@ type ImageGenerationRequest struct {
 	Size           string `json:"size,omitempty"`   // Optional. The size of the generated images
 	Style          string `json:"style,omitempty"`  // Optional. The style of the generated images
 	User           string `json:"user,omitempty"`   // Optional. A unique identifier representing your end-user
+
+	// 以下为扩展字段
+	Async       bool   `json:"async,omitempty"`        // 异步生成，立即返回任务ID
+	CallbackURL string `json:"callback_url,omitempty"` // 异步任务完成后接收结果的回调地址
 }
 
 // ImageGenerationResponse represents the response from the DALL-E image generation API
@@ -27,6 +35,32 @@ type ImageGenerationData struct {
 	RevisedPrompt string `json:"revised_prompt,omitempty"` // The prompt that was used to generate the image
 }
 
+// 异步图片任务状态
+const (
+	ImageJobQueued    = "queued"
+	ImageJobRunning   = "running"
+	ImageJobSucceeded = "succeeded"
+	ImageJobFailed    = "failed"
+)
+
+// ImageJob 异步图片生成任务
+type ImageJob struct {
+	ID          string                   `json:"id"`
+	Object      string                   `json:"object"` // 固定为 image.job
+	Status      string                   `json:"status"`
+	Progress    int                      `json:"progress"` // 0-100，按 Monica 预计的生成时间估算
+	CreatedAt   int64                    `json:"created_at"`
+	StartedAt   int64                    `json:"started_at,omitempty"`
+	CompletedAt int64                    `json:"completed_at,omitempty"`
+	Result      *ImageGenerationResponse `json:"result,omitempty"`
+	Error       *ImageJobError           `json:"error,omitempty"`
+}
+
+// ImageJobError 异步图片任务失败原因
+type ImageJobError struct {
+	Message string `json:"message"`
+}
+
 type ChatCompletionStreamResponse struct {
 	ID                  string                       `json:"id"`
 	Object              string                       `json:"object"`
@@ -44,4 +78,103 @@ type ChatCompletionStreamChoice struct {
 	Delta        openai.ChatCompletionStreamChoiceDelta     `json:"delta"`
 	Logprobs     *openai.ChatCompletionStreamChoiceLogprobs `json:"logprobs,omitempty"`
 	FinishReason openai.FinishReason                        `json:"finish_reason"`
+}
+
+// ChatMessagePartTypeFile OpenAI 的 file 类型内容片段，go-openai 未提供
+const ChatMessagePartTypeFile openai.ChatMessagePartType = "file"
+
+// ChatMessageFile file 类型内容片段的数据
+type ChatMessageFile struct {
+	FileID   string `json:"file_id,omitempty"`   // 已上传文件的ID
+	FileData string `json:"file_data,omitempty"` // data URI 格式的文件内容
+	Filename string `json:"filename,omitempty"`  // 文件名
+
+	// Resolved 通过 /v1/files 上传的文件，由服务层根据 FileID 填充
+	Resolved *FileInfo `json:"-"`
+}
+
+// MessageFiles 消息中 file 类型内容片段的数据，按 [消息下标][片段下标] 索引
+type MessageFiles map[int]map[int]*ChatMessageFile
+
+// Get 获取指定消息中指定片段的文件数据
+func (f MessageFiles) Get(message, part int) *ChatMessageFile {
+	if parts, ok := f[message]; ok {
+		return parts[part]
+	}
+	return nil
+}
+
+// ChatCompletionRequest 在 openai.ChatCompletionRequest 的基础上补充 go-openai 不会解析的 file 内容片段
+type ChatCompletionRequest struct {
+	openai.ChatCompletionRequest
+	Files MessageFiles `json:"-"`
+}
+
+// UnmarshalJSON 先按 OpenAI 格式解析请求，再单独提取 file 内容片段
+func (r *ChatCompletionRequest) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &r.ChatCompletionRequest); err != nil {
+		return err
+	}
+
+	var raw struct {
+		Messages []struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	r.Files = nil
+	for i, msg := range raw.Messages {
+		// 字符串内容不会包含文件
+		if len(msg.Content) == 0 || msg.Content[0] != '[' {
+			continue
+		}
+		var parts []struct {
+			Type string           `json:"type"`
+			File *ChatMessageFile `json:"file"`
+		}
+		if err := json.Unmarshal(msg.Content, &parts); err != nil {
+			return err
+		}
+		for j, part := range parts {
+			if part.Type != string(ChatMessagePartTypeFile) || part.File == nil {
+				continue
+			}
+			if r.Files == nil {
+				r.Files = make(MessageFiles)
+			}
+			if r.Files[i] == nil {
+				r.Files[i] = make(map[int]*ChatMessageFile)
+			}
+			r.Files[i][j] = part.File
+		}
+	}
+	return nil
+}
+
+// FileObject OpenAI Files API 的文件对象
+type FileObject struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+	Status    string `json:"status"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+// FileList /v1/files 列表响应
+type FileList struct {
+	Object string       `json:"object"`
+	Data   []FileObject `json:"data"`
+}
+
+// FileDeleteResponse 删除文件的响应
+type FileDeleteResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
 }
\ No newline at end of file
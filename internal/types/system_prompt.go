@@ -0,0 +1,91 @@
+package types
+
+import (
+	"fmt"
+	"monica-proxy/internal/config"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+)
+
+// systemPromptAck 使用 pair 策略时虚拟回复的内容
+const systemPromptAck = "OK. I will follow these instructions."
+
+// extractSystemPrompt 提取所有 system 消息的文本，支持字符串和 MultiContent 数组
+func extractSystemPrompt(messages []openai.ChatCompletionMessage) string {
+	var parts []string
+	for _, msg := range messages {
+		if msg.Role != openai.ChatMessageRoleSystem {
+			continue
+		}
+		if len(msg.MultiContent) > 0 {
+			for _, content := range msg.MultiContent {
+				if content.Type == openai.ChatMessagePartTypeText && content.Text != "" {
+					parts = append(parts, content.Text)
+				}
+			}
+			continue
+		}
+		if msg.Content != "" {
+			parts = append(parts, msg.Content)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// applySystemPrompt 按照配置的策略将 system prompt 写入 Item 链
+// items 不包含欢迎消息头，ParentItemID 由调用方统一设置
+func applySystemPrompt(strategy, prompt, conversationID string, items []Item) []Item {
+	if prompt == "" || strategy == config.SystemPromptNone {
+		return items
+	}
+
+	switch strategy {
+	case config.SystemPromptPair:
+		pair := []Item{
+			newTextItem(conversationID, "question", prompt),
+			newTextItem(conversationID, "reply", systemPromptAck),
+		}
+		return append(pair, items...)
+	case config.SystemPromptInject:
+		for i := len(items) - 1; i >= 0; i-- {
+			if items[i].ItemType == "question" {
+				items[i].Data.Content = prefixPrompt(prompt, items[i].Data.Content)
+				return items
+			}
+		}
+	default: // prepend
+		for i := range items {
+			if items[i].ItemType == "question" {
+				items[i].Data.Content = prefixPrompt(prompt, items[i].Data.Content)
+				return items
+			}
+		}
+	}
+
+	// 没有用户消息可以挂载时，单独作为一个问题发送
+	return append([]Item{newTextItem(conversationID, "question", prompt)}, items...)
+}
+
+// prefixPrompt 将 system prompt 拼接到消息内容前
+func prefixPrompt(prompt, content string) string {
+	if content == "" {
+		return prompt
+	}
+	return prompt + "\n\n" + content
+}
+
+// newTextItem 创建一个纯文本的 Item
+func newTextItem(conversationID, itemType, text string) Item {
+	return Item{
+		ConversationID: conversationID,
+		ItemID:         fmt.Sprintf("msg:%s", uuid.New().String()),
+		ItemType:       itemType,
+		Data: ItemContent{
+			Type:        "text",
+			Content:     text,
+			IsIncognito: true,
+		},
+	}
+}
@@ -0,0 +1,153 @@
+package types
+
+import (
+	"context"
+	"monica-proxy/internal/config"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// wantItem 期望的 Item 类型和文本内容
+type wantItem struct {
+	itemType string
+	content  string
+}
+
+func TestChatGPTToMonicaSystemPrompt(t *testing.T) {
+	multiContentSystem := openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleSystem,
+		MultiContent: []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: "Be brief."},
+			{Type: openai.ChatMessagePartTypeText, Text: "Answer in English."},
+		},
+	}
+	conversation := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "You are helpful."},
+		multiContentSystem,
+		{Role: openai.ChatMessageRoleUser, Content: "Hi"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "Hello"},
+		{Role: openai.ChatMessageRoleSystem, Content: "Use markdown."},
+		{Role: openai.ChatMessageRoleUser, Content: "How are you?"},
+	}
+	prompt := "You are helpful.\n\nBe brief.\n\nAnswer in English.\n\nUse markdown."
+
+	tests := []struct {
+		name     string
+		strategy string
+		messages []openai.ChatCompletionMessage
+		want     []wantItem
+	}{
+		{
+			name:     "prepend",
+			strategy: config.SystemPromptPrepend,
+			messages: conversation,
+			want: []wantItem{
+				{"question", prompt + "\n\nHi"},
+				{"reply", "Hello"},
+				{"question", "How are you?"},
+			},
+		},
+		{
+			name:     "pair",
+			strategy: config.SystemPromptPair,
+			messages: conversation,
+			want: []wantItem{
+				{"question", prompt},
+				{"reply", systemPromptAck},
+				{"question", "Hi"},
+				{"reply", "Hello"},
+				{"question", "How are you?"},
+			},
+		},
+		{
+			name:     "inject",
+			strategy: config.SystemPromptInject,
+			messages: conversation,
+			want: []wantItem{
+				{"question", "Hi"},
+				{"reply", "Hello"},
+				{"question", prompt + "\n\nHow are you?"},
+			},
+		},
+		{
+			name:     "none",
+			strategy: config.SystemPromptNone,
+			messages: conversation,
+			want: []wantItem{
+				{"question", "Hi"},
+				{"reply", "Hello"},
+				{"question", "How are you?"},
+			},
+		},
+		{
+			name:     "prepend without user message",
+			strategy: config.SystemPromptPrepend,
+			messages: []openai.ChatCompletionMessage{multiContentSystem},
+			want: []wantItem{
+				{"question", "Be brief.\n\nAnswer in English."},
+			},
+		},
+		{
+			name:     "inject without system message",
+			strategy: config.SystemPromptInject,
+			messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: "Hi"},
+			},
+			want: []wantItem{
+				{"question", "Hi"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Monica.SystemPromptStrategy = tt.strategy
+			chatReq := ChatCompletionRequest{
+				ChatCompletionRequest: openai.ChatCompletionRequest{
+					Model:    "gpt-4o",
+					Messages: tt.messages,
+				},
+			}
+
+			mReq, err := ChatGPTToMonica(context.Background(), cfg, chatReq)
+			if err != nil {
+				t.Fatalf("ChatGPTToMonica() error = %v", err)
+			}
+
+			items := mReq.Data.Items
+			if len(items) != len(tt.want)+1 {
+				t.Fatalf("got %d items, want %d", len(items), len(tt.want)+1)
+			}
+
+			welcome := items[0]
+			if welcome.ItemType != "reply" || welcome.Data.Content != "__RENDER_BOT_WELCOME_MSG__" {
+				t.Errorf("items[0] = %s %q, want welcome reply", welcome.ItemType, welcome.Data.Content)
+			}
+			if welcome.ParentItemID != "" {
+				t.Errorf("items[0].ParentItemID = %q, want empty", welcome.ParentItemID)
+			}
+
+			for i, want := range tt.want {
+				item := items[i+1]
+				if item.ItemType != want.itemType {
+					t.Errorf("items[%d].ItemType = %q, want %q", i+1, item.ItemType, want.itemType)
+				}
+				if item.Data.Content != want.content {
+					t.Errorf("items[%d].Data.Content = %q, want %q", i+1, item.Data.Content, want.content)
+				}
+				if item.ConversationID != mReq.Data.ConversationID {
+					t.Errorf("items[%d].ConversationID = %q, want %q", i+1, item.ConversationID, mReq.Data.ConversationID)
+				}
+				if item.ParentItemID != items[i].ItemID {
+					t.Errorf("items[%d].ParentItemID = %q, want %q", i+1, item.ParentItemID, items[i].ItemID)
+				}
+			}
+
+			if last := items[len(items)-1].ItemID; mReq.Data.PreParentItemID != last {
+				t.Errorf("PreParentItemID = %q, want %q", mReq.Data.PreParentItemID, last)
+			}
+		})
+	}
+}
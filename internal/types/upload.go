@@ -0,0 +1,169 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/errors"
+	"monica-proxy/internal/logger"
+	"monica-proxy/internal/tracing"
+	"monica-proxy/internal/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// 文件解析轮询相关常量
+const (
+	fileIndexPollInterval = 1 * time.Second
+	imageIndexAttempts    = 5   // 图片解析很快，最多轮询5次
+	documentIndexAttempts = 120 // 文档需要分块和索引，最多轮询2分钟
+)
+
+// uploadFile 将文件数据经过预签名、上传、创建文件对象和轮询解析结果后写入缓存
+func uploadFile(ctx context.Context, cfg *config.Config, cacheKey string, data []byte, fileInfo *FileInfo, maxAttempts int) (*FileInfo, error) {
+	// 5-6. 获取预签名URL并上传文件数据
+	objectURL, cdnURL, err := putObject(ctx, cfg, ImageModule, fileInfo.FileName, fileInfo.FileType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// 7. 创建文件对象
+	fileInfo.ObjectURL = objectURL
+	uploadReq := &FileUploadRequest{
+		Data: []FileInfo{*fileInfo},
+	}
+
+	var uploadResp FileUploadResponse
+	createCtx, createSpan := tracing.StartClient(ctx, "upload.create")
+	_, err = utils.RestyDefaultClient.R().
+		SetContext(createCtx).
+		SetHeader("cookie", cfg.Monica.Cookie).
+		SetBody(uploadReq).
+		SetResult(&uploadResp).
+		Post(FileUploadURL)
+	tracing.End(createSpan, err)
+
+	if err != nil {
+		return nil, fmt.Errorf("create file object failed: %v", err)
+	}
+	if len(uploadResp.Data.Items) > 0 {
+		fileInfo.FileName = uploadResp.Data.Items[0].FileName
+		fileInfo.FileType = uploadResp.Data.Items[0].FileType
+		fileInfo.FileSize = uploadResp.Data.Items[0].FileSize
+		fileInfo.FileUID = uploadResp.Data.Items[0].FileUID
+		fileInfo.FileExt = uploadResp.Data.Items[0].FileType
+		fileInfo.FileTokens = uploadResp.Data.Items[0].FileTokens
+		fileInfo.FileChunks = uploadResp.Data.Items[0].FileChunks
+	}
+
+	fileInfo.UseFullText = true
+	fileInfo.FileURL = cdnURL
+
+	// 8. 等待 Monica 完成文件解析
+	pollCtx, pollSpan := tracing.Start(ctx, "upload.poll", attribute.String("file.uid", fileInfo.FileUID))
+	err = waitFileIndexed(pollCtx, cfg, fileInfo, maxAttempts)
+	tracing.End(pollSpan, err)
+	if err != nil {
+		return nil, err
+	}
+	fileInfo.URL = ""
+	fileInfo.ObjectURL = ""
+
+	// 9. 保存到缓存
+	uploadCache.Set(cacheKey, fileInfo)
+
+	return fileInfo, nil
+}
+
+// putObject 获取预签名URL并上传文件数据，返回对象地址和CDN地址
+func putObject(ctx context.Context, cfg *config.Config, module, fileName, contentType string, data []byte) (string, string, error) {
+	preSignReq := &PreSignRequest{
+		FilenameList: []string{fileName},
+		Module:       module,
+		Location:     ImageLocation,
+		ObjID:        uuid.New().String(),
+	}
+
+	var preSignResp PreSignResponse
+	preSignCtx, preSignSpan := tracing.StartClient(ctx, "upload.presign", attribute.String("upload.module", module))
+	_, err := utils.RestyDefaultClient.R().
+		SetContext(preSignCtx).
+		SetHeader("cookie", cfg.Monica.Cookie).
+		SetBody(preSignReq).
+		SetResult(&preSignResp).
+		Post(PreSignURL)
+	tracing.End(preSignSpan, err)
+
+	if err != nil {
+		return "", "", fmt.Errorf("get pre-sign url failed: %v", err)
+	}
+
+	if len(preSignResp.Data.PreSignURLList) == 0 || len(preSignResp.Data.ObjectURLList) == 0 {
+		return "", "", fmt.Errorf("no pre-sign url or object url returned")
+	}
+
+	putCtx, putSpan := tracing.StartClient(ctx, "upload.put", attribute.Int("file.size", len(data)))
+	_, err = utils.RestyDefaultClient.R().
+		SetContext(putCtx).
+		SetHeader("Content-Type", contentType).
+		SetBody(data).
+		Put(preSignResp.Data.PreSignURLList[0])
+	tracing.End(putSpan, err)
+
+	if err != nil {
+		return "", "", fmt.Errorf("upload file failed: %v", err)
+	}
+
+	cdnURL := ""
+	if len(preSignResp.Data.CDNURLList) > 0 {
+		cdnURL = preSignResp.Data.CDNURLList[0]
+	}
+	return preSignResp.Data.ObjectURLList[0], cdnURL, nil
+}
+
+// waitFileIndexed 轮询 batch_get_file 直到文件解析完成，并回填分块和token信息
+// Monica 解析失败时返回带有其错误信息的 AppError
+func waitFileIndexed(ctx context.Context, cfg *config.Config, fileInfo *FileInfo, maxAttempts int) error {
+	reqMap := map[string][]string{"file_uids": {fileInfo.FileUID}}
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		var batchResp FileBatchGetResponse
+		_, err := utils.RestyDefaultClient.R().
+			SetContext(ctx).
+			SetHeader("cookie", cfg.Monica.Cookie).
+			SetBody(reqMap).
+			SetResult(&batchResp).
+			Post(FileGetURL)
+		if err != nil {
+			return fmt.Errorf("batch get file failed: %v", err)
+		}
+
+		if len(batchResp.Data.Items) > 0 {
+			item := batchResp.Data.Items[0]
+			if item.ErrorMessage != "" {
+				return errors.NewFileParseError(fileInfo.FileName, item.ErrorMessage)
+			}
+			// 部分文件不会返回解析进度，只要有分块就认为完成
+			if item.FileChunks > 0 && (item.IndexProgress == 0 || item.IndexProgress >= 100) {
+				fileInfo.FileChunks = item.FileChunks
+				fileInfo.FileTokens = item.FileTokens
+				return nil
+			}
+			logger.Debug("等待文件解析",
+				zap.String("file_uid", fileInfo.FileUID),
+				zap.Int("index_state", item.IndexState),
+				zap.Int("index_progress", item.IndexProgress),
+				zap.Int("attempt", attempt),
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(fileIndexPollInterval):
+		}
+	}
+	return fmt.Errorf("retry limit exceeded")
+}
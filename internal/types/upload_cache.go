@@ -0,0 +1,308 @@
+package types
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/logger"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// uploadCacheSaveInterval 缓存快照写入磁盘的间隔
+const uploadCacheSaveInterval = time.Minute
+
+// uploadCache 全局上传缓存，InitUploadCache 会按配置重新创建
+var uploadCache = NewUploadCache(config.UploadConfig{
+	CacheMaxEntries: 10000,
+	CacheMaxBytes:   32 * 1024 * 1024,
+	CacheTTL:        24 * time.Hour,
+})
+
+// UploadCacheStats 上传缓存统计信息
+type UploadCacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+}
+
+// uploadCacheEntry 缓存条目
+type uploadCacheEntry struct {
+	Key       string    `json:"key"`
+	File      *FileInfo `json:"file"`
+	ExpiresAt time.Time `json:"expires_at"`
+	size      int64
+}
+
+// UploadCache 按文件内容缓存已上传到Monica的文件信息
+// 超过条目数或大小限制时按LRU淘汰，条目过期时间与Monica文件的有效期保持一致
+type UploadCache struct {
+	mu         sync.Mutex
+	ll         *list.List
+	items      map[string]*list.Element
+	maxEntries int
+	maxBytes   int64
+	ttl        time.Duration
+	bytes      int64
+	path       string
+	dirty      bool
+	version    uint64     // 每次修改加一，保存成功后只有快照之后没有新修改才清除 dirty
+	saveMu     sync.Mutex // 串行化快照写入，避免定期保存和退出保存同时写临时文件
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+// NewUploadCache 创建上传缓存
+func NewUploadCache(cfg config.UploadConfig) *UploadCache {
+	return &UploadCache{
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		maxEntries: cfg.CacheMaxEntries,
+		maxBytes:   cfg.CacheMaxBytes,
+		ttl:        cfg.CacheTTL,
+		path:       cfg.CachePath,
+	}
+}
+
+// InitUploadCache 按配置初始化全局上传缓存，配置了持久化路径时加载快照并定期保存
+func InitUploadCache(cfg *config.Config) {
+	cache := NewUploadCache(cfg.Upload)
+	if cache.path != "" {
+		if err := cache.load(); err != nil {
+			logger.Warn("加载上传缓存失败", zap.String("path", cache.path), zap.Error(err))
+		}
+		go cache.saveLoop()
+	}
+	uploadCache = cache
+}
+
+// SaveUploadCache 将全局上传缓存写入磁盘，退出前调用，避免丢失最近一次定期保存之后的条目
+func SaveUploadCache() error {
+	return uploadCache.Save()
+}
+
+// UploadExpiresAt 获取已缓存的 Monica 文件的过期时间，命中缓存的上传返回的是之前上传的文件
+// 未缓存或缓存不过期时返回 false
+func UploadExpiresAt(fileUID string) (time.Time, bool) {
+	return uploadCache.ExpiresAt(fileUID)
+}
+
+// GetUploadCacheStats 获取全局上传缓存的统计信息
+func GetUploadCacheStats() UploadCacheStats {
+	return uploadCache.Stats()
+}
+
+// uploadCacheKey 根据账号和完整文件内容生成缓存key
+// 同一文件在不同Monica账号下的 file_uid 不通用，需要按账号隔离
+func uploadCacheKey(cfg *config.Config, data []byte) string {
+	sum := sha256.Sum256(data)
+	return AccountKey(cfg.Monica.Cookie) + ":" + hex.EncodeToString(sum[:])
+}
+
+// AccountKey 由cookie生成账号标识，避免在缓存和管理接口中暴露cookie本身
+func AccountKey(cookie string) string {
+	sum := sha256.Sum256([]byte(cookie))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Get 获取缓存的文件信息
+func (c *UploadCache) Get(key string) (*FileInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	entry := elem.Value.(*uploadCacheEntry)
+	if c.ttl > 0 && time.Now().After(entry.ExpiresAt) {
+		c.removeElement(elem)
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	c.hits.Add(1)
+	return entry.File, true
+}
+
+// Set 写入缓存，超过限制时淘汰最久未使用的条目
+func (c *UploadCache) Set(key string, file *FileInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+	entry := &uploadCacheEntry{
+		Key:       key,
+		File:      file,
+		ExpiresAt: time.Now().Add(c.ttl),
+	}
+	c.add(entry)
+	c.evict()
+}
+
+// ExpiresAt 按 file_uid 查找条目的过期时间
+func (c *UploadCache) ExpiresAt(fileUID string) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl <= 0 {
+		return time.Time{}, false
+	}
+	for elem := c.ll.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*uploadCacheEntry)
+		if entry.File.FileUID == fileUID {
+			return entry.ExpiresAt, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Stats 获取缓存统计信息
+func (c *UploadCache) Stats() UploadCacheStats {
+	c.mu.Lock()
+	entries, bytes := c.ll.Len(), c.bytes
+	c.mu.Unlock()
+
+	return UploadCacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Entries:   entries,
+		Bytes:     bytes,
+	}
+}
+
+// Save 将缓存快照写入磁盘，写入成功后才清除 dirty 标记，失败时下次继续保存
+func (c *UploadCache) Save() error {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	c.mu.Lock()
+	if c.path == "" || !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	// 从最旧到最新保存，加载时可以还原LRU顺序
+	entries := make([]*uploadCacheEntry, 0, c.ll.Len())
+	for elem := c.ll.Back(); elem != nil; elem = elem.Prev() {
+		entries = append(entries, elem.Value.(*uploadCacheEntry))
+	}
+	version := c.version
+	c.mu.Unlock()
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("create cache dir failed: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write cache failed: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("rename cache failed: %w", err)
+	}
+
+	c.mu.Lock()
+	if c.version == version {
+		c.dirty = false
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// load 从磁盘加载缓存快照，跳过已过期的条目
+func (c *UploadCache) load() error {
+	data, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var entries []*uploadCacheEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for _, entry := range entries {
+		if entry.File == nil || (c.ttl > 0 && now.After(entry.ExpiresAt)) {
+			continue
+		}
+		c.add(entry)
+	}
+	c.evict()
+	c.dirty = false
+	return nil
+}
+
+// saveLoop 定期保存缓存快照
+func (c *UploadCache) saveLoop() {
+	ticker := time.NewTicker(uploadCacheSaveInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := c.Save(); err != nil {
+			logger.Warn("保存上传缓存失败", zap.String("path", c.path), zap.Error(err))
+		}
+	}
+}
+
+// add 添加条目到链表头部，调用方需持有锁
+func (c *UploadCache) add(entry *uploadCacheEntry) {
+	entry.size = entrySize(entry)
+	c.items[entry.Key] = c.ll.PushFront(entry)
+	c.bytes += entry.size
+	c.markDirty()
+}
+
+// evict 淘汰超出限制的条目，调用方需持有锁
+func (c *UploadCache) evict() {
+	for c.ll.Len() > 0 &&
+		((c.maxEntries > 0 && c.ll.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes)) {
+		c.removeElement(c.ll.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// removeElement 删除条目，调用方需持有锁
+func (c *UploadCache) removeElement(elem *list.Element) {
+	entry := c.ll.Remove(elem).(*uploadCacheEntry)
+	delete(c.items, entry.Key)
+	c.bytes -= entry.size
+	c.markDirty()
+}
+
+// markDirty 标记缓存有未保存的修改，调用方需持有锁
+func (c *UploadCache) markDirty() {
+	c.dirty = true
+	c.version++
+}
+
+// entrySize 估算条目占用的内存大小
+func entrySize(entry *uploadCacheEntry) int64 {
+	f := entry.File
+	size := len(entry.Key) + len(f.URL) + len(f.FileURL) + len(f.FileUID) + len(f.FileName) +
+		len(f.FileType) + len(f.FileExt) + len(f.ObjectURL)
+	return int64(size) + 128 // 结构体本身和其他字段的大致开销
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"monica-proxy/internal/config"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// RemoteFetchClient 用于下载客户端提供的远程文件（如图片URL），将在初始化时设置
+var RemoteFetchClient *http.Client
+
+// WebhookClient 用于向客户端提供的回调地址发送通知，与 RemoteFetchClient 使用相同的地址限制
+var WebhookClient *http.Client
+
+// remoteFetchMaxSize 远程文件最大字节数
+var remoteFetchMaxSize int64
+
+// 额外需要拦截的地址段，标准库的 IsPrivate 等方法未覆盖
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",     // 本网络
+	"100.64.0.0/10", // 运营商级NAT
+	"192.0.0.0/24",  // IETF协议分配
+	"198.18.0.0/15", // 基准测试
+	"64:ff9b::/96",  // NAT64
+)
+
+// createRemoteFetchClient 创建远程文件下载客户端
+func createRemoteFetchClient(cfg *config.Config) *http.Client {
+	remoteFetchMaxSize = cfg.Upload.RemoteFetchMaxSize
+	return newGuardedHTTPClient(cfg, cfg.Upload.RemoteFetchTimeout, cfg.Upload.RemoteFetchMaxRedirects)
+}
+
+// createWebhookClient 创建回调通知客户端，回调不跟随重定向
+func createWebhookClient(cfg *config.Config) *http.Client {
+	return newGuardedHTTPClient(cfg, cfg.Image.WebhookTimeout, 0)
+}
+
+// newGuardedHTTPClient 创建访问客户端提供的地址时使用的HTTP客户端
+// 在建立连接时校验实际解析出的IP，避免DNS重绑定绕过内网地址限制
+func newGuardedHTTPClient(cfg *config.Config, timeout time.Duration, maxRedirects int) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if !cfg.Upload.RemoteFetchAllowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || isBlockedIP(ip) {
+				return fmt.Errorf("access to address %s is not allowed", host)
+			}
+			return nil
+		}
+	}
+
+	transport := &http.Transport{
+		Proxy:               nil, // 不走代理，否则拦截的是代理地址而不是目标地址
+		DialContext:         dialer.DialContext,
+		MaxIdleConns:        cfg.HTTPClient.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.HTTPClient.MaxIdleConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLSClientConfig: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		},
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme: %s", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// FetchRemoteFile 下载远程文件，返回文件内容和根据内容嗅探出的MIME类型
+func FetchRemoteFile(ctx context.Context, rawURL string) ([]byte, string, error) {
+	if RemoteFetchClient == nil {
+		return nil, "", fmt.Errorf("remote fetch is disabled")
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, "", fmt.Errorf("unsupported url scheme: %s", u.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; monica-proxy)")
+
+	resp, err := RemoteFetchClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("fetch remote file failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("fetch remote file failed: status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > remoteFetchMaxSize {
+		return nil, "", fmt.Errorf("remote file size exceeds limit: %d > %d", resp.ContentLength, remoteFetchMaxSize)
+	}
+
+	// 多读一个字节用于判断是否超过大小限制
+	data, err := io.ReadAll(io.LimitReader(resp.Body, remoteFetchMaxSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("read remote file failed: %w", err)
+	}
+	if int64(len(data)) > remoteFetchMaxSize {
+		return nil, "", fmt.Errorf("remote file size exceeds limit: %d", remoteFetchMaxSize)
+	}
+
+	// 不信任服务端声明的 Content-Type，以内容嗅探结果为准
+	return data, DetectImageType(data), nil
+}
+
+// isBlockedIP 判断是否为不允许访问的内网、回环或保留地址
+func isBlockedIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// mustParseCIDRs 解析CIDR列表，仅用于初始化常量
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
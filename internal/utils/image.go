@@ -0,0 +1,317 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	xdraw "golang.org/x/image/draw"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// ImageProcessOptions 图片预处理参数
+type ImageProcessOptions struct {
+	MaxDimension  int   // 最长边的最大像素数，0 表示不限制
+	MaxPixels     int64 // 允许解码的最大像素数（宽×高），0 表示不限制
+	MaxBytes      int64 // 输出文件的最大字节数
+	JPEGQuality   int   // JPEG 初始编码质量
+	StripMetadata bool  // 是否去除 JPEG、PNG、WebP 中的 EXIF、XMP 和文本元数据
+}
+
+// ErrImageTooLarge 图片声明的像素数超过限制，在解码前拒绝，避免小文件声明巨大尺寸导致分配大量内存
+var ErrImageTooLarge = errors.New("image pixel count exceeds limit")
+
+// 最低的 JPEG 编码质量，低于这个值时改为继续缩小尺寸
+const minJPEGQuality = 40
+
+// PreprocessImage 对图片进行预处理：转换不支持的格式、缩小尺寸、去除元数据并压缩到大小限制以内
+// 不需要处理时原样返回；返回处理后的数据和对应的MIME类型
+// 没有 WebP 编码器，需要处理的 WebP 按是否透明输出 PNG 或 JPEG；动图原样返回，避免只剩第一帧
+func PreprocessImage(data []byte, opts ImageProcessOptions) ([]byte, string, error) {
+	mimeType := DetectImageType(data)
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("decode image config failed: %w", err)
+	}
+	if opts.MaxPixels > 0 && int64(cfg.Width)*int64(cfg.Height) > opts.MaxPixels {
+		return nil, "", fmt.Errorf("%w: %dx%d > %d", ErrImageTooLarge, cfg.Width, cfg.Height, opts.MaxPixels)
+	}
+
+	oversized := opts.MaxDimension > 0 && max(cfg.Width, cfg.Height) > opts.MaxDimension
+	tooLarge := opts.MaxBytes > 0 && int64(len(data)) > opts.MaxBytes
+	convert := mimeType == "image/bmp" || mimeType == "image/tiff"
+	hasMetadata := opts.StripMetadata && containsMetadata(data, mimeType)
+
+	if !oversized && !tooLarge && !convert && !hasMetadata {
+		return data, mimeType, nil
+	}
+	if mimeType == "image/gif" && isAnimatedGIF(data) {
+		return data, mimeType, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("decode image failed: %w", err)
+	}
+
+	// 去除 EXIF 后方向信息也会丢失，需要先按方向旋转
+	if mimeType == "image/jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	if oversized {
+		img = resizeImage(img, opts.MaxDimension)
+	}
+
+	// 有透明像素的图片和无损格式输出 PNG，超出大小限制时再铺白底转为 JPEG
+	if !isOpaque(img) || (mimeType != "image/jpeg" && mimeType != "image/webp") {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", fmt.Errorf("encode png failed: %w", err)
+		}
+		if opts.MaxBytes <= 0 || int64(buf.Len()) <= opts.MaxBytes {
+			return buf.Bytes(), "image/png", nil
+		}
+	}
+
+	out, err := encodeJPEGWithinLimit(img, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	return out, "image/jpeg", nil
+}
+
+// DetectImageType 根据内容判断文件类型，补充 http.DetectContentType 无法识别的 TIFF
+func DetectImageType(data []byte) string {
+	if bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")) {
+		return "image/tiff"
+	}
+	return http.DetectContentType(data)
+}
+
+// encodeJPEGWithinLimit 逐步降低质量编码 JPEG，仍然超出大小限制时缩小尺寸后重试
+func encodeJPEGWithinLimit(img image.Image, opts ImageProcessOptions) ([]byte, error) {
+	quality := opts.JPEGQuality
+	if quality <= 0 || quality > 100 {
+		quality = 85
+	}
+	img = flattenAlpha(img)
+
+	var buf bytes.Buffer
+	for {
+		for q := quality; ; q -= 10 {
+			q = max(q, minJPEGQuality)
+			buf.Reset()
+			if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: q}); err != nil {
+				return nil, fmt.Errorf("encode jpeg failed: %w", err)
+			}
+			if opts.MaxBytes <= 0 || int64(buf.Len()) <= opts.MaxBytes {
+				return buf.Bytes(), nil
+			}
+			if q == minJPEGQuality {
+				break
+			}
+		}
+
+		bounds := img.Bounds()
+		longest := max(bounds.Dx(), bounds.Dy())
+		if longest <= 64 {
+			return nil, fmt.Errorf("image cannot be compressed under %d bytes", opts.MaxBytes)
+		}
+		img = resizeImage(img, longest*3/4)
+	}
+}
+
+// resizeImage 等比缩放图片，使最长边不超过 maxDimension
+func resizeImage(img image.Image, maxDimension int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if max(w, h) <= maxDimension {
+		return img
+	}
+
+	if w >= h {
+		h = max(1, h*maxDimension/w)
+		w = maxDimension
+	} else {
+		w = max(1, w*maxDimension/h)
+		h = maxDimension
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, xdraw.Src, nil)
+	return dst
+}
+
+// isOpaque 图片是否没有透明像素，无法判断的类型按有透明像素处理
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// isAnimatedGIF GIF 是否包含多帧
+func isAnimatedGIF(data []byte) bool {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	return err == nil && len(g.Image) > 1
+}
+
+// flattenAlpha 将透明背景填充为白色，JPEG 不支持透明通道
+func flattenAlpha(img image.Image) image.Image {
+	if isOpaque(img) {
+		return img
+	}
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
+
+// containsMetadata 判断图片是否带有 EXIF、XMP 或文本元数据，重新编码后这些数据会被丢弃
+func containsMetadata(data []byte, mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg":
+		head := data[:min(len(data), 64*1024)]
+		return bytes.Contains(head, []byte("Exif\x00\x00")) || bytes.Contains(head, []byte("http://ns.adobe.com/xap/1.0/"))
+	case "image/png":
+		return pngHasMetadata(data)
+	case "image/webp":
+		// VP8X 扩展格式的标志位中记录了是否包含 EXIF (0x08) 和 XMP (0x04)
+		return len(data) >= 21 && string(data[12:16]) == "VP8X" && data[20]&0x0C != 0
+	}
+	return false
+}
+
+// pngHasMetadata 遍历 PNG 数据块，查找 eXIf、tEXt、iTXt、zTXt 块
+func pngHasMetadata(data []byte) bool {
+	pos := 8 // PNG 文件头
+	for pos+8 <= len(data) {
+		size := int(binary.BigEndian.Uint32(data[pos:]))
+		switch string(data[pos+4 : pos+8]) {
+		case "eXIf", "tEXt", "iTXt", "zTXt":
+			return true
+		case "IEND":
+			return false
+		}
+		if size < 0 || size > len(data) {
+			return false
+		}
+		pos += 12 + size // 长度、类型、数据和 CRC
+	}
+	return false
+}
+
+// jpegOrientation 读取 JPEG EXIF 中的方向信息，没有时返回 1
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// 遍历 JPEG 段，找到 APP1 Exif 段
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		size := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if marker == 0xDA || size < 2 || pos+2+size > len(data) { // 图像数据开始
+			return 1
+		}
+		segment := data[pos+4 : pos+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		pos += 2 + size
+	}
+	return 1
+}
+
+// exifOrientation 从 TIFF 格式的 EXIF 数据中读取 IFD0 的 Orientation 标签
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+// applyOrientation 按 EXIF 方向旋转或翻转图片
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	// 5-8 需要交换宽高
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // 水平翻转
+				dx, dy = w-1-x, y
+			case 3: // 旋转180度
+				dx, dy = w-1-x, h-1-y
+			case 4: // 垂直翻转
+				dx, dy = x, h-1-y
+			case 5: // 沿左上-右下对角线翻转
+				dx, dy = y, x
+			case 6: // 顺时针旋转90度
+				dx, dy = h-1-y, x
+			case 7: // 沿右上-左下对角线翻转
+				dx, dy = h-1-y, w-1-x
+			case 8: // 逆时针旋转90度
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// encodePNG 编码测试用的 PNG 图片
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pngChunk 构造一个 PNG 数据块
+func pngChunk(kind string, data []byte) []byte {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+	buf.WriteString(kind)
+	buf.Write(data)
+	_ = binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(append([]byte(kind), data...)))
+	return buf.Bytes()
+}
+
+// transparentImage 左半边透明、右半边红色的图片
+func transparentImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := w / 2; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+	return img
+}
+
+func TestPreprocessImageRejectsTooManyPixels(t *testing.T) {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr, 60000)
+	binary.BigEndian.PutUint32(ihdr[4:], 60000)
+	ihdr[8], ihdr[9] = 8, 6
+	data := append([]byte("\x89PNG\r\n\x1a\n"), pngChunk("IHDR", ihdr)...)
+
+	_, _, err := PreprocessImage(data, ImageProcessOptions{MaxPixels: 50_000_000})
+	if !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("err = %v, want ErrImageTooLarge", err)
+	}
+}
+
+func TestPreprocessImageKeepsTransparencyAsPNG(t *testing.T) {
+	data := encodePNG(t, transparentImage(400, 200))
+
+	out, mimeType, err := PreprocessImage(data, ImageProcessOptions{MaxDimension: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mimeType != "image/png" {
+		t.Fatalf("mimeType = %s, want image/png", mimeType)
+	}
+	img, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Dx(); got != 100 {
+		t.Errorf("width = %d, want 100", got)
+	}
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("alpha at transparent pixel = %d, want 0", a)
+	}
+}
+
+func TestPreprocessImageFlattensTransparencyForJPEG(t *testing.T) {
+	// 噪点图片使 PNG 超出大小限制，只能转为 JPEG
+	img := transparentImage(256, 256)
+	for y := 0; y < 256; y++ {
+		for x := 128; x < 256; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * y), G: uint8(x + y*7), B: uint8(x ^ y), A: 255})
+		}
+	}
+	data := encodePNG(t, img)
+
+	out, mimeType, err := PreprocessImage(data, ImageProcessOptions{MaxBytes: int64(len(data)) / 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mimeType != "image/jpeg" {
+		t.Fatalf("mimeType = %s, want image/jpeg", mimeType)
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, g, b, _ := decoded.At(10, 10).RGBA()
+	if r>>8 < 240 || g>>8 < 240 || b>>8 < 240 {
+		t.Errorf("transparent area = (%d, %d, %d), want white", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestPreprocessImageStripsPNGMetadata(t *testing.T) {
+	data := encodePNG(t, transparentImage(4, 4))
+	text := pngChunk("tEXt", []byte("Comment\x00secret location"))
+	withText := append(append(append([]byte{}, data[:33]...), text...), data[33:]...)
+
+	out, mimeType, err := PreprocessImage(withText, ImageProcessOptions{StripMetadata: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mimeType != "image/png" || bytes.Contains(out, []byte("secret")) {
+		t.Errorf("metadata not stripped: mimeType = %s", mimeType)
+	}
+
+	out, _, err = PreprocessImage(data, ImageProcessOptions{StripMetadata: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("image without metadata was re-encoded")
+	}
+}
+
+func TestPreprocessImagePassesAnimatedGIF(t *testing.T) {
+	palette := color.Palette{color.White, color.Black}
+	anim := &gif.GIF{}
+	for i := 0; i < 2; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 300, 300), palette)
+		frame.SetColorIndex(i, i, 1)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+
+	out, mimeType, err := PreprocessImage(buf.Bytes(), ImageProcessOptions{MaxDimension: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mimeType != "image/gif" || !bytes.Equal(out, buf.Bytes()) {
+		t.Errorf("animated gif was modified: mimeType = %s", mimeType)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/logger"
+	"monica-proxy/internal/metrics"
+	"monica-proxy/internal/redact"
 	"net"
 	"net/http"
 	"time"
@@ -23,6 +25,10 @@ var (
 func InitHTTPClients(cfg *config.Config) {
 	RestySSEClient = createSSEClient(cfg)
 	RestyDefaultClient = createDefaultClient(cfg)
+	if cfg.Upload.RemoteFetchEnabled {
+		RemoteFetchClient = createRemoteFetchClient(cfg)
+	}
+	WebhookClient = createWebhookClient(cfg)
 }
 
 // createSSEClient 创建SSE专用客户端
@@ -59,16 +65,10 @@ func createSSEClient(cfg *config.Config) *resty.Client {
 			"Accept":          "text/event-stream,application/json",
 		}).
 		OnBeforeRequest(func(c *resty.Client, r *resty.Request) error {
-			// Логируем HTTP заголовки перед отправкой
-			headers := make(map[string]string)
-			for k, v := range r.Header {
-				if len(v) > 0 {
-					headers[k] = v[0] // Берем первое значение
-				}
-			}
+			// Логируем HTTP заголовки перед отправкой (cookie и токены скрываются)
 			logger.Info("HTTP заголовки запроса к Monica",
-				zap.Any("headers", headers),
-				zap.String("url", r.URL),
+				zap.Any("headers", redact.Headers(r.Header)),
+				zap.String("url", redact.URL(r.URL)),
 				zap.String("method", r.Method),
 			)
 			return nil
@@ -76,10 +76,11 @@ func createSSEClient(cfg *config.Config) *resty.Client {
 		OnAfterResponse(func(c *resty.Client, resp *resty.Response) error {
 			if resp.StatusCode() >= 400 {
 				return fmt.Errorf("monica API error: status %d, body: %s",
-					resp.StatusCode(), resp.String())
+					resp.StatusCode(), redact.Body(resp.Body()))
 			}
 			return nil
-		})
+		}).
+		OnError(metrics.UpstreamErrorHook("sse"))
 
 	// 添加重试条件
 	client.AddRetryCondition(func(r *resty.Response, err error) bool {
@@ -123,10 +124,11 @@ func createDefaultClient(cfg *config.Config) *resty.Client {
 		OnAfterResponse(func(c *resty.Client, resp *resty.Response) error {
 			if resp.StatusCode() >= 400 {
 				return fmt.Errorf("monica API error: status %d, body: %s",
-					resp.StatusCode(), resp.String())
+					resp.StatusCode(), redact.Body(resp.Body()))
 			}
 			return nil
-		})
+		}).
+		OnError(metrics.UpstreamErrorHook("default"))
 
 	// 添加重试条件
 	client.AddRetryCondition(func(r *resty.Response, err error) bool {
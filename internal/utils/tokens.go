@@ -0,0 +1,53 @@
+package utils
+
+import "unicode"
+
+// Monica 不返回 token 用量，这里按字符粗略估算：
+// 中日韩等宽字符每个约 1 个 token，其余字符约 4 个为 1 个 token
+const tokenUnitsPerToken = 4
+
+// runeTokenUnits 单个字符的估算单位数
+func runeTokenUnits(r rune) int {
+	if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+		return tokenUnitsPerToken
+	}
+	return 1
+}
+
+// EstimateTokens 估算文本的 token 数
+func EstimateTokens(s string) int {
+	var e TokenEstimator
+	e.Add(s)
+	return e.Tokens()
+}
+
+// TokenEstimator 累计估算流式文本的 token 数
+type TokenEstimator struct {
+	units int
+}
+
+// Tokens 已累计的 token 数
+func (e *TokenEstimator) Tokens() int {
+	return (e.units + tokenUnitsPerToken - 1) / tokenUnitsPerToken
+}
+
+// Add 累计文本
+func (e *TokenEstimator) Add(s string) {
+	for _, r := range s {
+		e.units += runeTokenUnits(r)
+	}
+}
+
+// Take 在累计总数不超过 limit 个 token 的前提下尽量多地接收 s
+// 返回接收的前缀，以及 s 是否被截断
+func (e *TokenEstimator) Take(s string, limit int) (string, bool) {
+	budget := limit * tokenUnitsPerToken
+	for i, r := range s {
+		units := runeTokenUnits(r)
+		if e.units+units > budget {
+			return s[:i], true
+		}
+		e.units += units
+	}
+	return s, false
+}
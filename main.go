@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"monica-proxy/internal/apiserver"
 	"monica-proxy/internal/config"
 	"monica-proxy/internal/logger"
+	"monica-proxy/internal/redact"
+	"monica-proxy/internal/tracing"
+	"monica-proxy/internal/types"
 	"monica-proxy/internal/utils"
 	customMiddleware "monica-proxy/internal/middleware"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -15,26 +25,75 @@ import (
 )
 
 func main() {
+	// 子命令：离线重放 SSE 捕获文件
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(runReplay(os.Args[2:]))
+	}
+	// 子命令：模拟 Monica API 的本地服务
+	if len(os.Args) > 1 && os.Args[1] == "mock" {
+		os.Exit(runMock(os.Args[2:]))
+	}
+
 	// 加载配置
 	cfg, err := config.Load()
 	if err != nil {
 		panic(fmt.Sprintf("Failed to load config: %v", err))
 	}
 
-	// 设置日志级别
-	logger.SetLevel(cfg.Logging.Level)
+	// 按配置初始化日志
+	if err := logger.Init(cfg.Logging); err != nil {
+		panic(fmt.Sprintf("Failed to init logger: %v", err))
+	}
+	defer logger.Sync()
+	redact.Init(cfg.Logging)
+
+	// 初始化链路追踪
+	shutdownTracing, err := tracing.Init(cfg)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to init tracing: %v", err))
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Warn("刷新链路追踪数据失败", zap.Error(err))
+		}
+	}()
 
 	// 创建应用实例
 	app := newApp(cfg)
 
+	// 收到退出信号时停止接收新请求，等待进行中的请求结束
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+		<-quit
+		logger.Info("正在关闭服务器")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := app.Shutdown(ctx); err != nil {
+			logger.Warn("关闭服务器失败", zap.Error(err))
+		}
+	}()
+
 	// 启动服务器
 	logger.Info("启动服务器", zap.String("address", cfg.GetAddress()))
 
-	if err := app.Start(); err != nil {
+	if err := app.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		logger.Fatal("启动服务器失败", zap.Error(err))
 	}
+	<-shutdownDone
+
+	// 保存上传缓存，避免丢失最近一次定期保存之后的条目
+	if err := types.SaveUploadCache(); err != nil {
+		logger.Warn("保存上传缓存失败", zap.Error(err))
+	}
+	logger.Info("服务器已关闭")
 }
 
+// shutdownTimeout 优雅关闭时等待进行中请求的最长时间
+const shutdownTimeout = 30 * time.Second
+
 // App 应用实例
 type App struct {
 	config *config.Config
@@ -46,6 +105,12 @@ func newApp(cfg *config.Config) *App {
 	// 初始化HTTP客户端
 	utils.InitHTTPClients(cfg)
 
+	// 设置 Monica API 地址
+	types.InitMonicaURLs(cfg)
+
+	// 初始化上传缓存
+	types.InitUploadCache(cfg)
+
 	// 设置 Echo Server
 	e := echo.New()
 	e.Logger.SetOutput(io.Discard)
@@ -60,6 +125,7 @@ func newApp(cfg *config.Config) *App {
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
 	e.Use(middleware.RequestID())
+	e.Use(customMiddleware.Tracing())
 	
 	// 添加限流中间件
 	e.Use(customMiddleware.RateLimit(cfg))
@@ -77,3 +143,8 @@ func newApp(cfg *config.Config) *App {
 func (a *App) Start() error {
 	return a.server.Start(a.config.GetAddress())
 }
+
+// Shutdown 优雅关闭应用
+func (a *App) Shutdown(ctx context.Context) error {
+	return a.server.Shutdown(ctx)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"monica-proxy/internal/mock"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runMock 启动模拟 Monica API 的本地服务，配合 MONICA_BASE_URL 在没有 Cookie 时开发和测试
+func runMock(args []string) int {
+	fs := flag.NewFlagSet("mock", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: monica-proxy mock [flags]")
+		fs.PrintDefaults()
+	}
+	addr := fs.String("addr", "127.0.0.1:9090", "listen address")
+	publicURL := fs.String("public-url", "", "base URL used in upload and CDN links, defaults to http://<addr>")
+	var opts mock.Options
+	fs.StringVar(&opts.Cookie, "cookie", "", "require this Cookie header, empty accepts any request")
+	fs.DurationVar(&opts.Latency, "latency", 0, "delay before every API response")
+	fs.DurationVar(&opts.ChunkDelay, "chunk-delay", 50*time.Millisecond, "delay between SSE chunks")
+	fs.Float64Var(&opts.FailRate, "fail-rate", 0, "fraction of API requests that fail (0-1)")
+	fs.IntVar(&opts.FailStatus, "fail-status", http.StatusInternalServerError, "HTTP status of injected failures")
+	fs.DurationVar(&opts.IndexDelay, "index-delay", time.Second, "time until uploaded files finish indexing")
+	fs.DurationVar(&opts.ImageDelay, "image-delay", 2*time.Second, "time until image tasks complete")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if opts.FailRate < 0 || opts.FailRate > 1 {
+		fmt.Fprintln(os.Stderr, "fail-rate must be between 0 and 1")
+		return 2
+	}
+
+	baseURL := *publicURL
+	if baseURL == "" {
+		baseURL = "http://" + *addr
+	}
+	server := &http.Server{
+		Addr:    *addr,
+		Handler: mock.NewServer(baseURL, opts).Handler(),
+	}
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+		<-quit
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "mock Monica API listening on %s, set MONICA_BASE_URL=%s\n", *addr, baseURL)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
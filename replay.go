@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/logger"
+	"monica-proxy/internal/monica"
+	"os"
+	"strings"
+)
+
+// runReplay 离线重放 SSE 捕获文件，将转换后的 OpenAI 格式输出打印到 stdout
+// 多个文件作为同一个请求的多个 choice (n>1) 处理，不需要配置和网络
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: monica-proxy replay [flags] <capture.sse> [capture.sse...]")
+		fs.PrintDefaults()
+	}
+	model := fs.String("model", "gpt-4o", "model name written to the output")
+	stream := fs.Bool("stream", true, "print SSE chunks like a streaming response; false prints a chat.completion JSON")
+	stop := fs.String("stop", "", "comma separated stop sequences")
+	maxTokens := fs.Int("max-tokens", 0, "max_tokens limit, 0 means unlimited")
+	id := fs.String("id", "chatcmpl-replay", "response id written to the output")
+	created := fs.Int64("created", 0, "created timestamp written to the output")
+	fingerprint := fs.String("fingerprint", "replay", "system_fingerprint written to streaming chunks")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	// 日志输出到 stderr，避免混入重放结果
+	if err := logger.Init(config.LoggingConfig{Level: "warn", Format: config.LogFormatConsole, Output: config.LogOutputStderr}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var streams monica.ChoiceStreams
+	defer func() { _ = streams.Close() }()
+	for _, path := range fs.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		streams = append(streams, file)
+	}
+
+	limits := monica.OutputLimits{MaxTokens: *maxTokens}
+	if *stop != "" {
+		limits.Stop = strings.Split(*stop, ",")
+	}
+
+	// 固定响应 ID、时间戳和指纹，同一个捕获文件每次重放的输出完全一致
+	ctx := monica.WithResponseMeta(context.Background(), monica.ResponseMeta{
+		ID:          *id,
+		Created:     *created,
+		Fingerprint: *fingerprint,
+	})
+
+	if *stream {
+		if err := monica.StreamMonicaSSEToClient(ctx, *model, os.Stdout, limits, streams.Readers()...); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	completion, err := monica.CollectChoicesToCompletion(ctx, *model, limits, streams)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := writeJSON(os.Stdout, completion); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// writeJSON 以缩进格式输出 JSON
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(v)
+}